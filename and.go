@@ -13,7 +13,18 @@ func NewAnd(expr Expr) *And {
 }
 
 func (a *And) Parse(scan *Scanner) (*Tree, bool) {
-	drop := NewScanner(scan.Text[scan.Pos:])
-	_, ok := a.expr.Parse(drop)
+	pos, lpos := scan.Pos, scan.LPos
+	_, ok := scan.parse(a.expr)
+	scan.Pos, scan.LPos = pos, lpos
+	if scan.err != nil {
+		return nil, false
+	}
 	return nil, ok
 }
+
+func (a *And) Match(scan *Scanner) bool {
+	pos, lpos := scan.Pos, scan.LPos
+	ok := scan.match(a.expr)
+	scan.Pos, scan.LPos = pos, lpos
+	return scan.err == nil && ok
+}
@@ -0,0 +1,70 @@
+package peg
+
+// arenaSlab is the number of trees or child pointers allocated at once.
+const arenaSlab = 256
+
+// Arena allocates the trees of a parse in large slabs. Trees from an arena
+// have a nil Tags map: their tags are kept in a small list, so callers must
+// read them with Tree.HasTag and Tree.TagNames rather than Tags. Child
+// lists are ranges of a shared slice whose capacity ends with the range,
+// so appending to them copies the list first.
+//
+// Trees stay valid until Reset is called. An Arena must not be used by
+// several scanners at the same time.
+type Arena struct {
+	trees [][]Tree
+	kids  [][]*Tree
+	ntree int
+	nkid  int
+}
+
+// WithArena makes the scanner allocate its trees from a.
+func WithArena(a *Arena) ScannerOption {
+	return func(s *Scanner) {
+		s.arena = a
+	}
+}
+
+func NewArena() *Arena {
+	return new(Arena)
+}
+
+// Reset makes the memory of every tree allocated so far available for
+// reuse. Trees allocated before must no longer be used.
+func (a *Arena) Reset() {
+	a.ntree = 0
+	a.nkid = 0
+}
+
+func (a *Arena) tree(pos int) *Tree {
+	i := a.ntree / arenaSlab
+	if i == len(a.trees) {
+		a.trees = append(a.trees, make([]Tree, arenaSlab))
+	}
+	t := &a.trees[i][a.ntree%arenaSlab]
+	a.ntree++
+	*t = Tree{Start: pos, End: pos}
+	return t
+}
+
+// children returns an empty slice with capacity n carved from the slab.
+func (a *Arena) children(n int) []*Tree {
+	if n == 0 {
+		return nil
+	}
+	if n > arenaSlab {
+		return make([]*Tree, 0, n)
+	}
+	i := a.nkid / arenaSlab
+	off := a.nkid % arenaSlab
+	if off+n > arenaSlab {
+		i++
+		off = 0
+		a.nkid = i * arenaSlab
+	}
+	if i == len(a.kids) {
+		a.kids = append(a.kids, make([]*Tree, arenaSlab))
+	}
+	a.nkid += n
+	return a.kids[i][off : off : off+n]
+}
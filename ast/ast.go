@@ -0,0 +1,139 @@
+// Package ast defines the syntax tree of the .peg grammar language.
+package ast
+
+type AST interface {
+}
+
+// Span is the range of a node in the source text, in bytes.
+type Span struct {
+	Start int
+	End   int
+}
+
+// Range returns the span. Nodes embed a Span, which makes them Nodes.
+func (s Span) Range() Span {
+	return s
+}
+
+// Node is a node that knows where it was written.
+type Node interface {
+	Range() Span
+}
+
+type Expr interface {
+	Node
+}
+
+type Program struct {
+	Span
+	// Filename and Text are the source of the program, which errors
+	// found after parsing point into.
+	Filename string
+	Text     string
+	Stmts    []DefineStmt
+}
+
+type DefineStmt struct {
+	Span
+	Annotations []Annotation
+	Ident       Ident
+	// Label is the display name of the rule, if any.
+	Label string
+	// Doc is the text of the comments right above the rule, without the
+	// comment markers.
+	Doc  string
+	Expr Expr
+}
+
+// Annotation is a marker such as @nomemo placed before a rule.
+type Annotation struct {
+	Span
+	Name string
+}
+
+type SequenceExpr struct {
+	Span
+	Exprs []Expr
+}
+
+type ChoiceExpr struct {
+	Span
+	Exprs []Expr
+}
+
+type ZeroOrMoreExpr struct {
+	Span
+	Expr Expr
+}
+
+type OneOrMoreExpr struct {
+	Span
+	Expr Expr
+}
+
+type RepeatExpr struct {
+	Span
+	Expr  Expr
+	Limit Limit
+}
+
+type OptionalExpr struct {
+	Span
+	Expr Expr
+}
+
+// TagExpr tags the tree of Expr with Name, written as name:expr or
+// @name(expr).
+type TagExpr struct {
+	Span
+	Name string
+	Expr Expr
+}
+
+type AndExpr struct {
+	Span
+	Expr Expr
+}
+
+type NotExpr struct {
+	Span
+	Expr Expr
+}
+
+type Charclass struct {
+	Span
+	Invert bool
+	Set    []CharRange
+}
+
+type CharRange struct {
+	Span
+	Lower rune
+	Upper rune
+}
+
+type Literal struct {
+	Span
+	Text string
+}
+
+type Ident struct {
+	Span
+	Name string
+}
+
+type Limit struct {
+	Span
+	Lower      int
+	Upper      int
+	LowerValid bool
+	UpperValid bool
+}
+
+type Any struct {
+	Span
+}
+
+type EOT struct {
+	Span
+}
@@ -0,0 +1,532 @@
+package peg
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/khirono/go-peg/ast"
+)
+
+type ASTBuilder struct {
+	filename string
+	text     string
+}
+
+func NewASTBuilder(filename, text string) *ASTBuilder {
+	b := new(ASTBuilder)
+	b.filename = filename
+	b.text = text
+	return b
+}
+
+func (b *ASTBuilder) Text(t *Tree) string {
+	return b.text[t.Start:t.End]
+}
+
+func (b *ASTBuilder) Span(t *Tree) ast.Span {
+	return ast.Span{Start: t.Start, End: t.End}
+}
+
+// errorf reports a problem with the source of t as a *Diagnostic.
+func (b *ASTBuilder) errorf(t *Tree, format string, args ...any) error {
+	return &Diagnostic{
+		Filename: b.filename,
+		Text:     b.text,
+		Start:    t.Start,
+		End:      t.End,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+func (b *ASTBuilder) Build(t *Tree) (*ast.Program, error) {
+	return b.Program(t)
+}
+
+func (b *ASTBuilder) Program(t *Tree) (*ast.Program, error) {
+	prog := &ast.Program{
+		Span:     b.Span(t),
+		Filename: b.filename,
+		Text:     b.text,
+	}
+	// program <- S0 (statement S0)* EOT
+	comments := b.Comments(t, nil)
+	for _, child := range t.Child[1].Child {
+		stmt, err := b.Statement(child.Child[0])
+		if err != nil {
+			return prog, err
+		}
+		stmt.Doc = b.Doc(comments, child.Child[0].Start)
+		prog.Stmts = append(prog.Stmts, *stmt)
+	}
+	return prog, nil
+}
+
+// Comments appends the comment trees under t to list, in order.
+func (b *ASTBuilder) Comments(t *Tree, list []*Tree) []*Tree {
+	if t == nil {
+		return list
+	}
+	if t.HasTag("rule:comment") {
+		return append(list, t)
+	}
+	for _, child := range t.Child {
+		list = b.Comments(child, list)
+	}
+	return list
+}
+
+// Doc returns the text of the comments on lines of their own that end on
+// the line right above pos. Comments are usually read by the S0 at the end
+// of the previous statement.
+func (b *ASTBuilder) Doc(comments []*Tree, pos int) string {
+	i := sort.Search(len(comments), func(i int) bool {
+		return comments[i].End > pos
+	})
+	var doc []string
+	end := pos
+	for i--; i >= 0; i-- {
+		c := comments[i]
+		gap := b.text[c.End:end]
+		if strings.TrimSpace(gap) != "" || strings.Count(gap, "\n") > 1 {
+			break
+		}
+		bol := strings.LastIndexByte(b.text[:c.Start], '\n') + 1
+		if strings.TrimSpace(b.text[bol:c.Start]) != "" {
+			// a comment after code belongs to the code
+			break
+		}
+		doc = append(commentLines(b.Text(c)), doc...)
+		end = c.Start
+	}
+	return strings.Join(doc, "\n")
+}
+
+// commentLines returns the lines of a comment without its markers.
+func commentLines(text string) []string {
+	switch {
+	case strings.HasPrefix(text, "#"):
+		return []string{strings.TrimPrefix(text[1:], " ")}
+	case strings.HasPrefix(text, "//"):
+		return []string{strings.TrimPrefix(text[2:], " ")}
+	}
+	text = strings.TrimSuffix(strings.TrimPrefix(text, "/*"), "*/")
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimLeft(line, " \t")
+		line = strings.TrimPrefix(line, "*")
+		line = strings.TrimPrefix(line, " ")
+		lines = append(lines, strings.TrimRight(line, " \t\r"))
+	}
+	// drop the empty lines of the markers
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func (b *ASTBuilder) Statement(t *Tree) (*ast.DefineStmt, error) {
+	// statement <- annotation* ident S0 (literal S0)? "<-" S0 expression
+	stmt := &ast.DefineStmt{}
+	for _, child := range t.Child[0].Child {
+		a, err := b.Annotation(child)
+		if err != nil {
+			return stmt, err
+		}
+		stmt.Annotations = append(stmt.Annotations, *a)
+	}
+	ident, err := b.Ident(t.Child[1])
+	if err != nil {
+		return stmt, err
+	}
+	if t.Child[3] != nil {
+		label, err := b.Literal(t.Child[3].Child[0])
+		if err != nil {
+			return stmt, err
+		}
+		stmt.Label = label.Text
+	}
+	expr, err := b.Expression(t.Child[6])
+	if err != nil {
+		return stmt, err
+	}
+	stmt.Span = ast.Span{Start: t.Start, End: b.expressionEnd(t.Child[6])}
+	stmt.Ident = *ident
+	stmt.Expr = expr
+	return stmt, nil
+}
+
+func (b *ASTBuilder) Annotation(t *Tree) (*ast.Annotation, error) {
+	// annotation <- "@" ident S0
+	a := &ast.Annotation{}
+	a.Span = ast.Span{Start: t.Start, End: t.Child[1].End}
+	a.Name = b.Text(t.Child[1])
+	switch a.Name {
+	case "memo", "nomemo":
+		return a, nil
+	default:
+		return a, b.errorf(t.Child[1], "unknown annotation @%v", a.Name)
+	}
+}
+
+func (b *ASTBuilder) Expression(t *Tree) (ast.Expr, error) {
+	// expression <- sequence ("/" S0 sequence)*
+	expr, err := b.Sequence(t.Child[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(t.Child[1].Child) == 0 {
+		return expr, nil
+	}
+	choice := &ast.ChoiceExpr{}
+	choice.Exprs = append(choice.Exprs, expr)
+	for _, child := range t.Child[1].Child {
+		expr, err := b.Sequence(child.Child[2])
+		if err != nil {
+			return choice, err
+		}
+		choice.Exprs = append(choice.Exprs, expr)
+	}
+	choice.Span = ast.Span{Start: t.Start, End: b.expressionEnd(t)}
+	return choice, nil
+}
+
+func (b *ASTBuilder) Sequence(t *Tree) (ast.Expr, error) {
+	// sequence <- (term S0)+
+	if len(t.Child) == 1 {
+		return b.Term(t.Child[0].Child[0])
+	}
+	seq := &ast.SequenceExpr{}
+	for _, child := range t.Child {
+		expr, err := b.Term(child.Child[0])
+		if err != nil {
+			return seq, err
+		}
+		seq.Exprs = append(seq.Exprs, expr)
+	}
+	seq.Span = ast.Span{Start: t.Start, End: b.sequenceEnd(t)}
+	return seq, nil
+}
+
+// expressionEnd returns the end of the last term of an expression.
+func (b *ASTBuilder) expressionEnd(t *Tree) int {
+	alts := t.Child[1].Child
+	if len(alts) == 0 {
+		return b.sequenceEnd(t.Child[0])
+	}
+	return b.sequenceEnd(alts[len(alts)-1].Child[2])
+}
+
+// sequenceEnd returns the end of the last term of a sequence, as the tree
+// of the sequence ends with the spaces after it.
+func (b *ASTBuilder) sequenceEnd(t *Tree) int {
+	return t.Child[len(t.Child)-1].Child[0].End
+}
+
+func (b *ASTBuilder) Term(t *Tree) (ast.Expr, error) {
+	// term <-
+	//   labeled /
+	//   andpred /
+	//   notpred /
+	//   factor
+	switch t.Index {
+	case 0:
+		// labeled <- ident ":" term
+		expr, err := b.Term(t.Child[2])
+		if err != nil {
+			return nil, err
+		}
+		return &ast.TagExpr{Span: b.Span(t), Name: b.Text(t.Child[0]), Expr: expr}, nil
+	case 1:
+		// andpred <- "&" factor
+		expr, err := b.Factor(t.Child[1])
+		if err != nil {
+			return nil, err
+		}
+		return &ast.AndExpr{Span: b.Span(t), Expr: expr}, nil
+	case 2:
+		// notpred <- "!" factor
+		expr, err := b.Factor(t.Child[1])
+		if err != nil {
+			return nil, err
+		}
+		return &ast.NotExpr{Span: b.Span(t), Expr: expr}, nil
+	case 3:
+		return b.Factor(t)
+	default:
+		return nil, fmt.Errorf("invalid index %v", t.Index)
+	}
+}
+
+func (b *ASTBuilder) Factor(t *Tree) (ast.Expr, error) {
+	// factor <- primary ("?" / "*" / "+" / repeat)?
+	expr, err := b.Primary(t.Child[0])
+	if err != nil {
+		return nil, err
+	}
+	if t.Child[1] == nil {
+		return expr, nil
+	}
+	switch t.Child[1].Index {
+	case 0:
+		return &ast.OptionalExpr{Span: b.Span(t), Expr: expr}, nil
+	case 1:
+		return &ast.ZeroOrMoreExpr{Span: b.Span(t), Expr: expr}, nil
+	case 2:
+		return &ast.OneOrMoreExpr{Span: b.Span(t), Expr: expr}, nil
+	case 3:
+		limit, err := b.Repeat(t.Child[1])
+		if err != nil {
+			return expr, err
+		}
+		return &ast.RepeatExpr{Span: b.Span(t), Expr: expr, Limit: *limit}, nil
+	default:
+		return nil, fmt.Errorf("invalid index %v", t.Index)
+	}
+}
+
+func (b *ASTBuilder) Repeat(t *Tree) (*ast.Limit, error) {
+	// repeat <- "{" S0 (
+	//   digits S0 "," S0 digits /
+	//   digits S0 "," /
+	//   "," S0 digits /
+	//   digits
+	//   ) S0 "}"
+	l := &ast.Limit{}
+	l.Span = b.Span(t)
+	t = t.Child[2]
+	switch t.Index {
+	case 0:
+		lower, err := b.Digits(t.Child[0])
+		if err != nil {
+			return nil, err
+		}
+		upper, err := b.Digits(t.Child[4])
+		if err != nil {
+			return nil, err
+		}
+		l.Lower = lower
+		l.Upper = upper
+		l.LowerValid = true
+		l.UpperValid = true
+		return l, nil
+	case 1:
+		lower, err := b.Digits(t.Child[0])
+		if err != nil {
+			return nil, err
+		}
+		l.Lower = lower
+		l.LowerValid = true
+		return l, nil
+	case 2:
+		upper, err := b.Digits(t.Child[2])
+		if err != nil {
+			return nil, err
+		}
+		l.Upper = upper
+		l.UpperValid = true
+		return l, nil
+	case 3:
+		v, err := b.Digits(t)
+		if err != nil {
+			return nil, err
+		}
+		l.Lower = v
+		l.Upper = v
+		l.LowerValid = true
+		l.UpperValid = true
+		return l, nil
+	default:
+		return nil, fmt.Errorf("invalid index %v", t.Index)
+	}
+}
+
+func (b *ASTBuilder) Primary(t *Tree) (ast.Expr, error) {
+	// primary <-
+	//   "(" S0 expression ")" /
+	//   "EOT" /
+	//   charclass /
+	//   refident /
+	//   literal /
+	//   "." /
+	//   tag
+	switch t.Index {
+	case 0:
+		return b.Expression(t.Child[2])
+	case 1:
+		return &ast.EOT{Span: b.Span(t)}, nil
+	case 2:
+		return b.Charclass(t)
+	case 3:
+		return b.RefIdent(t)
+	case 4:
+		return b.Literal(t)
+	case 5:
+		return &ast.Any{Span: b.Span(t)}, nil
+	case 6:
+		return b.Tag(t)
+	default:
+		return nil, fmt.Errorf("invalid index %v", t.Index)
+	}
+}
+
+func (b *ASTBuilder) Tag(t *Tree) (*ast.TagExpr, error) {
+	// tag <- "@" ident "(" S0 expression ")"
+	expr, err := b.Expression(t.Child[4])
+	if err != nil {
+		return nil, err
+	}
+	return &ast.TagExpr{Span: b.Span(t), Name: b.Text(t.Child[1]), Expr: expr}, nil
+}
+
+func (b *ASTBuilder) Charclass(t *Tree) (*ast.Charclass, error) {
+	// charclass <- "[" "^"? (!"]" Range)+ "]"
+	charclass := &ast.Charclass{}
+	charclass.Span = b.Span(t)
+	if t.Child[1] != nil {
+		charclass.Invert = true
+	}
+	for _, child := range t.Child[2].Child {
+		r, err := b.Range(child.Child[1])
+		if err != nil {
+			return charclass, err
+		}
+		charclass.Set = append(charclass.Set, *r)
+	}
+	return charclass, nil
+}
+
+func (b *ASTBuilder) RefIdent(t *Tree) (*ast.Ident, error) {
+	// refident <- ident !(S0 (literal S0)? "<-")
+	ident := &ast.Ident{}
+	ident.Span = b.Span(t.Child[0])
+	ident.Name = b.Text(t.Child[0])
+	return ident, nil
+}
+
+func (b *ASTBuilder) Ident(t *Tree) (*ast.Ident, error) {
+	// ident <- (letter / "_") (letter / digit / "_" / "-")*
+	ident := &ast.Ident{}
+	ident.Span = b.Span(t)
+	ident.Name = b.Text(t)
+	return ident, nil
+}
+
+func (b *ASTBuilder) Literal(t *Tree) (*ast.Literal, error) {
+	// literal <-
+	//   '"' (!'"' Char)* '"' /
+	//   "'' (!"'" Char)* "'"
+	l := &ast.Literal{}
+	l.Span = b.Span(t)
+	var sb strings.Builder
+	for _, child := range t.Child[1].Child {
+		ch, err := b.Char(child.Child[1])
+		if err != nil {
+			return l, err
+		}
+		sb.WriteRune(ch)
+	}
+	l.Text = sb.String()
+	return l, nil
+}
+
+func (b *ASTBuilder) Range(t *Tree) (*ast.CharRange, error) {
+	// Range <- Char "-" Char / Char
+	r := &ast.CharRange{}
+	r.Span = b.Span(t)
+	switch t.Index {
+	case 0:
+		lower, err := b.Char(t.Child[0])
+		if err != nil {
+			return nil, err
+		}
+		r.Lower = lower
+		upper, err := b.Char(t.Child[2])
+		if err != nil {
+			return nil, err
+		}
+		r.Upper = upper
+		return r, nil
+	case 1:
+		ch, err := b.Char(t)
+		if err != nil {
+			return nil, err
+		}
+		r.Lower = ch
+		r.Upper = ch
+		return r, nil
+	default:
+		return nil, fmt.Errorf("invalid index %v", t.Index)
+	}
+}
+
+func (b *ASTBuilder) Char(t *Tree) (rune, error) {
+	// Char <-
+	//   "\\" [abefnrtv'"\[\]\\] /
+	//   "\\" [0-3] [0-7] [0-7] /
+	//   "\\" [0-7] [0-7]? /
+	//   "\\" "-" /
+	//   !"\\" .
+	switch t.Index {
+	case 0:
+		ch, _ := utf8.DecodeRuneInString(b.Text(t.Child[1]))
+		switch ch {
+		case 'a':
+			return '\a', nil
+		case 'b':
+			return '\b', nil
+		case 'e':
+			return '\x1b', nil
+		case 'f':
+			return '\f', nil
+		case 'n':
+			return '\n', nil
+		case 'r':
+			return '\r', nil
+		case 't':
+			return '\t', nil
+		case 'v':
+			return '\v', nil
+		default:
+			return ch, nil
+		}
+	case 1:
+		text := b.text[t.Child[1].Start:t.Child[3].End]
+		v, err := strconv.ParseUint(text, 8, 32)
+		if err != nil {
+			return 0, err
+		}
+		return rune(v), nil
+	case 2:
+		text := b.Text(t.Child[1])
+		if t.Child[2] != nil {
+			text += b.Text(t.Child[2])
+		}
+		v, err := strconv.ParseUint(text, 8, 32)
+		if err != nil {
+			return 0, err
+		}
+		return rune(v), nil
+	case 3:
+		return '-', nil
+	case 4:
+		ch, _ := utf8.DecodeRuneInString(b.Text(t.Child[1]))
+		return ch, nil
+	default:
+		return 0, fmt.Errorf("invalid index %v", t.Index)
+	}
+}
+
+func (b *ASTBuilder) Digits(t *Tree) (int, error) {
+	// digits <- [1-9] [0-9]* / "0"
+	v, err := strconv.ParseInt(b.Text(t), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return int(v), nil
+}
@@ -17,9 +17,11 @@ func NewCharclass(set RuneSubset) *Charclass {
 }
 
 func (c *Charclass) Parse(scan *Scanner) (*Tree, bool) {
-	t := NewTree(scan.Pos)
+	t := scan.newTree(scan.Pos)
 	ch, size := utf8.DecodeRuneInString(scan.Text[scan.Pos:])
+	scan.examineRune(scan.Pos, size)
 	if size == 0 {
+		scan.expectClass(c.set)
 		return t, false
 	}
 	if !c.set.Within(ch) {
@@ -32,3 +34,20 @@ func (c *Charclass) Parse(scan *Scanner) (*Tree, bool) {
 	t.End = scan.Pos
 	return t, true
 }
+
+func (c *Charclass) Match(scan *Scanner) bool {
+	ch, size := utf8.DecodeRuneInString(scan.Text[scan.Pos:])
+	scan.examineRune(scan.Pos, size)
+	if size == 0 {
+		scan.expectClass(c.set)
+		return false
+	}
+	if !c.set.Within(ch) {
+		return false
+	}
+	scan.Pos += size
+	if scan.Pos > scan.LPos {
+		scan.LPos = scan.Pos
+	}
+	return true
+}
@@ -0,0 +1,276 @@
+package peg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/khirono/go-peg/ast"
+)
+
+// Check reports the semantic problems of a program parsed by ParseGrammar,
+// sorted by position. A program without rules, undefined and duplicate
+// rules, left recursion and limits whose lower bound is over the upper one
+// are errors. Rules that the first rule never reaches and unbounded
+// repetitions of expressions that can match the empty string are warnings.
+func Check(prog *ast.Program) []*Diagnostic {
+	c := &checker{
+		prog: prog,
+		defs: make(map[string]*ast.DefineStmt),
+		null: make(map[string]bool),
+	}
+	if len(prog.Stmts) == 0 {
+		c.report(SeverityError, prog, "no rules")
+	}
+	for i := range prog.Stmts {
+		stmt := &prog.Stmts[i]
+		if prev, ok := c.defs[stmt.Ident.Name]; ok {
+			line, _ := lineCol(prog.Text, prev.Ident.Start)
+			c.report(SeverityError, stmt.Ident, "rule %v redefined, first defined on line %v", stmt.Ident.Name, line)
+			continue
+		}
+		c.defs[stmt.Ident.Name] = stmt
+	}
+	c.nullables()
+	for _, stmt := range prog.Stmts {
+		c.expr(stmt.Expr)
+	}
+	c.unreachable()
+	c.leftRecursion()
+	sort.SliceStable(c.diags, func(i, j int) bool {
+		return c.diags[i].Start < c.diags[j].Start
+	})
+	return c.diags
+}
+
+type checker struct {
+	prog  *ast.Program
+	defs  map[string]*ast.DefineStmt
+	null  map[string]bool
+	diags []*Diagnostic
+}
+
+func (c *checker) report(sev Severity, n ast.Node, format string, args ...any) {
+	span := n.Range()
+	c.diags = append(c.diags, &Diagnostic{
+		Severity: sev,
+		Filename: c.prog.Filename,
+		Text:     c.prog.Text,
+		Start:    span.Start,
+		End:      span.End,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// nullables finds the rules that can match the empty string, repeating
+// until no more rule is found.
+func (c *checker) nullables() {
+	for changed := true; changed; {
+		changed = false
+		for name, stmt := range c.defs {
+			if !c.null[name] && c.nullable(stmt.Expr) {
+				c.null[name] = true
+				changed = true
+			}
+		}
+	}
+}
+
+// nullable reports whether e can succeed without consuming input, as far
+// as the rules found so far tell.
+func (c *checker) nullable(e ast.Expr) bool {
+	switch e := e.(type) {
+	case *ast.SequenceExpr:
+		for _, x := range e.Exprs {
+			if !c.nullable(x) {
+				return false
+			}
+		}
+		return true
+	case *ast.ChoiceExpr:
+		for _, x := range e.Exprs {
+			if c.nullable(x) {
+				return true
+			}
+		}
+		return false
+	case *ast.ZeroOrMoreExpr, *ast.OptionalExpr, *ast.AndExpr, *ast.NotExpr, *ast.EOT:
+		return true
+	case *ast.OneOrMoreExpr:
+		return c.nullable(e.Expr)
+	case *ast.TagExpr:
+		return c.nullable(e.Expr)
+	case *ast.RepeatExpr:
+		return !e.Limit.LowerValid || e.Limit.Lower == 0 || c.nullable(e.Expr)
+	case *ast.Literal:
+		return e.Text == ""
+	case *ast.Ident:
+		return c.null[e.Name]
+	default:
+		return false
+	}
+}
+
+// expr checks the references, limits and repetitions under e.
+func (c *checker) expr(e ast.Expr) {
+	switch e := e.(type) {
+	case *ast.SequenceExpr:
+		for _, x := range e.Exprs {
+			c.expr(x)
+		}
+	case *ast.ChoiceExpr:
+		for _, x := range e.Exprs {
+			c.expr(x)
+		}
+	case *ast.ZeroOrMoreExpr:
+		c.repetition(e, e.Expr)
+		c.expr(e.Expr)
+	case *ast.OneOrMoreExpr:
+		c.repetition(e, e.Expr)
+		c.expr(e.Expr)
+	case *ast.RepeatExpr:
+		l := e.Limit
+		if l.LowerValid && l.UpperValid && l.Lower > l.Upper {
+			c.report(SeverityError, l, "invalid limit: lower bound %v is greater than upper bound %v", l.Lower, l.Upper)
+		}
+		if !l.UpperValid {
+			c.repetition(e, e.Expr)
+		}
+		c.expr(e.Expr)
+	case *ast.OptionalExpr:
+		c.expr(e.Expr)
+	case *ast.TagExpr:
+		c.expr(e.Expr)
+	case *ast.AndExpr:
+		c.expr(e.Expr)
+	case *ast.NotExpr:
+		c.expr(e.Expr)
+	case *ast.Ident:
+		if _, ok := c.defs[e.Name]; !ok {
+			msg := fmt.Sprintf("undefined rule %v", e.Name)
+			if list := suggest(e.Name, c.names()); len(list) > 0 {
+				msg += "; " + didYouMean(list)
+			}
+			c.report(SeverityError, e, "%s", msg)
+		}
+	}
+}
+
+// repetition warns about the repetition r of x if x can match the empty
+// string, as r then stops at the first time it does.
+func (c *checker) repetition(r ast.Node, x ast.Expr) {
+	if c.nullable(x) {
+		c.report(SeverityWarning, r, "repeated expression can match the empty string")
+	}
+}
+
+func (c *checker) names() []string {
+	names := make([]string, len(c.prog.Stmts))
+	for i, stmt := range c.prog.Stmts {
+		names[i] = stmt.Ident.Name
+	}
+	return names
+}
+
+// unreachable warns about the rules that the first rule does not use.
+func (c *checker) unreachable() {
+	if len(c.prog.Stmts) == 0 {
+		return
+	}
+	start := c.prog.Stmts[0].Ident.Name
+	seen := map[string]bool{start: true}
+	queue := []string{start}
+	for len(queue) > 0 {
+		stmt := c.defs[queue[0]]
+		queue = queue[1:]
+		for _, ref := range refs(stmt.Expr, nil, nil) {
+			if _, ok := c.defs[ref.Name]; ok && !seen[ref.Name] {
+				seen[ref.Name] = true
+				queue = append(queue, ref.Name)
+			}
+		}
+	}
+	for i, stmt := range c.prog.Stmts {
+		if !seen[stmt.Ident.Name] && c.defs[stmt.Ident.Name] == &c.prog.Stmts[i] {
+			c.report(SeverityWarning, stmt.Ident, "rule %v is not reachable from %v", stmt.Ident.Name, start)
+		}
+	}
+}
+
+// refs appends the references under e to list. If first is not nil, only
+// the references that may be called at the position where e starts are
+// appended.
+func refs(e ast.Expr, list []*ast.Ident, first func(ast.Expr) bool) []*ast.Ident {
+	switch e := e.(type) {
+	case *ast.SequenceExpr:
+		for _, x := range e.Exprs {
+			list = refs(x, list, first)
+			if first != nil && !first(x) {
+				break
+			}
+		}
+	case *ast.ChoiceExpr:
+		for _, x := range e.Exprs {
+			list = refs(x, list, first)
+		}
+	case *ast.ZeroOrMoreExpr:
+		list = refs(e.Expr, list, first)
+	case *ast.OneOrMoreExpr:
+		list = refs(e.Expr, list, first)
+	case *ast.RepeatExpr:
+		list = refs(e.Expr, list, first)
+	case *ast.OptionalExpr:
+		list = refs(e.Expr, list, first)
+	case *ast.TagExpr:
+		list = refs(e.Expr, list, first)
+	case *ast.AndExpr:
+		list = refs(e.Expr, list, first)
+	case *ast.NotExpr:
+		list = refs(e.Expr, list, first)
+	case *ast.Ident:
+		list = append(list, e)
+	}
+	return list
+}
+
+// leftRecursion reports the cycles of rules that call each other without
+// consuming input, which never end. Each cycle is reported once, at the
+// reference of its first rule that starts it.
+func (c *checker) leftRecursion() {
+	reported := make(map[string]bool)
+	for i := range c.prog.Stmts {
+		stmt := &c.prog.Stmts[i]
+		name := stmt.Ident.Name
+		if reported[name] || c.defs[name] != stmt {
+			continue
+		}
+		path := c.leftPath(name, name, make(map[string]bool))
+		if path == nil {
+			continue
+		}
+		names := []string{name}
+		for _, ref := range path {
+			names = append(names, ref.Name)
+			reported[ref.Name] = true
+		}
+		c.report(SeverityError, path[0], "left recursion: %v", strings.Join(names, " -> "))
+	}
+}
+
+// leftPath returns the references leading from rule from back to rule to
+// without consuming input, or nil.
+func (c *checker) leftPath(from, to string, seen map[string]bool) []*ast.Ident {
+	seen[from] = true
+	for _, ref := range refs(c.defs[from].Expr, nil, c.nullable) {
+		if ref.Name == to {
+			return []*ast.Ident{ref}
+		}
+		if _, ok := c.defs[ref.Name]; !ok || seen[ref.Name] {
+			continue
+		}
+		if path := c.leftPath(ref.Name, to, seen); path != nil {
+			return append([]*ast.Ident{ref}, path...)
+		}
+	}
+	return nil
+}
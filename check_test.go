@@ -0,0 +1,79 @@
+package peg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "clean",
+			src:  "a <- b+ EOT\nb <- \"x\" / &\"y\" \"y\" a",
+		},
+		{
+			name: "undefined",
+			src:  "a <- \"x\" wrod word\nword <- [a-z]+",
+			want: []string{"1:10: undefined rule wrod; did you mean \"word\"?"},
+		},
+		{
+			name: "duplicate",
+			src:  "a <- b\nb <- \"x\"\nb <- \"y\"",
+			want: []string{"3:1: rule b redefined, first defined on line 2"},
+		},
+		{
+			name: "unreachable",
+			src:  "a <- \"x\"\nb <- c\nc <- \"y\"",
+			want: []string{
+				"2:1: warning: rule b is not reachable from a",
+				"3:1: warning: rule c is not reachable from a",
+			},
+		},
+		{
+			name: "nullable",
+			src:  "a <- (\"x\"?)* b+ b{2,} b{2,3}\nb <- \"y\"* !\"z\"",
+			want: []string{
+				"1:6: warning: repeated expression can match the empty string",
+				"1:14: warning: repeated expression can match the empty string",
+				"1:17: warning: repeated expression can match the empty string",
+			},
+		},
+		{
+			name: "left recursion",
+			src:  "a <- b \"+\" c / c\nb <- \"-\"? !\"x\" a\nc <- c? \"y\"",
+			want: []string{
+				"1:6: left recursion: a -> b -> a",
+				"3:6: left recursion: c -> c",
+			},
+		},
+		{
+			name: "limit",
+			src:  "a <- \"x\"{3,2} \"y\"{2,2}",
+			want: []string{"1:9: invalid limit: lower bound 3 is greater than upper bound 2"},
+		},
+		{
+			name: "empty",
+			src:  "# nothing",
+			want: []string{"1:1: no rules"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			prog, err := ParseGrammar("", tc.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, d := range Check(prog) {
+				got = append(got, d.Error())
+			}
+			if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+				t.Errorf("want %q; but got %q", tc.want, got)
+			}
+		})
+	}
+}
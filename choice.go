@@ -15,8 +15,13 @@ func NewChoice(exprs ...Expr) *Choice {
 func (c *Choice) Parse(scan *Scanner) (*Tree, bool) {
 	pos := scan.Pos
 	for i, expr := range c.exprs {
-		t, ok := expr.Parse(scan)
+		t, ok := scan.parse(expr)
 		if ok {
+			// an alternative that matched nothing, such as a skipped
+			// Optional, has no tree to carry the index
+			if t == nil {
+				t = scan.newTree(pos)
+			}
 			t.Index = i
 			return t, true
 		}
@@ -24,3 +29,14 @@ func (c *Choice) Parse(scan *Scanner) (*Tree, bool) {
 	}
 	return nil, false
 }
+
+func (c *Choice) Match(scan *Scanner) bool {
+	pos := scan.Pos
+	for _, expr := range c.exprs {
+		if scan.match(expr) {
+			return true
+		}
+		scan.Pos = pos
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/khirono/go-peg"
+)
+
+func BenchmarkMemo(b *testing.B) {
+	data, err := os.ReadFile("../../examples/codegen-ipv6/ipv6addr.peg")
+	if err != nil {
+		b.Fatal(err)
+	}
+	backends := []struct {
+		name string
+		opts []peg.ScannerOption
+	}{
+		{"map", []peg.ScannerOption{peg.WithMapMemo()}},
+		{"dense", nil},
+	}
+	g := peg.NewPEGGrammar()
+	for _, backend := range backends {
+		b.Run("parse/"+backend.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				scan := peg.NewScanner(string(data), backend.opts...)
+				if _, ok := g.Parse(scan); !ok {
+					b.Fatalf("not accepted")
+				}
+			}
+		})
+		// Match builds no trees, which leaves the memo table as the
+		// main cost.
+		b.Run("match/"+backend.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, ok := peg.Match(g, string(data), backend.opts...); !ok {
+					b.Fatalf("not accepted")
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkVM(b *testing.B) {
+	data, err := os.ReadFile("../../examples/codegen-ipv6/ipv6addr.peg")
+	if err != nil {
+		b.Fatal(err)
+	}
+	g := peg.NewPEGGrammar()
+	vm, err := peg.Compile(g)
+	if err != nil {
+		b.Fatal(err)
+	}
+	engines := []struct {
+		name string
+		g    peg.Expr
+	}{
+		{"interpreter", g},
+		{"vm", vm},
+	}
+	for _, engine := range engines {
+		b.Run("parse/"+engine.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				scan := peg.NewScanner(string(data))
+				if _, ok := engine.g.Parse(scan); !ok {
+					b.Fatalf("not accepted")
+				}
+			}
+		})
+		b.Run("match/"+engine.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, ok := peg.Match(engine.g, string(data)); !ok {
+					b.Fatalf("not accepted")
+				}
+			}
+		})
+	}
+}
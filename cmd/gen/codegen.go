@@ -4,9 +4,15 @@ import (
 	"bytes"
 	"fmt"
 	"go/format"
+	"go/token"
+	"strings"
+	"unicode"
+
+	"github.com/khirono/go-peg"
+	"github.com/khirono/go-peg/ast"
 )
 
-func GenerateCode(pkgname, funcname string, prog *Program) ([]byte, error) {
+func GenerateCode(pkgname, funcname string, prog *ast.Program, optimize bool) ([]byte, error) {
 	var buf bytes.Buffer
 
 	fmt.Fprintln(&buf, "// Code generated by gen; DO NOT EDIT.")
@@ -19,64 +25,184 @@ func GenerateCode(pkgname, funcname string, prog *Program) ([]byte, error) {
 	fmt.Fprintln(&buf, "")
 	fmt.Fprintf(&buf, "func %s() peg.Expr {\n", funcname)
 
+	ids := goIdents(prog)
+	if optimize {
+		if err := generateOptimized(&buf, prog, ids); err != nil {
+			return nil, err
+		}
+		fmt.Fprintln(&buf, "}")
+		return format.Source(buf.Bytes())
+	}
 	for _, stmt := range prog.Stmts {
-		fmt.Fprintf(&buf, "\t%s := peg.NewRule(\"%s\")\n", stmt.Ident.Name, stmt.Ident.Name)
+		fmt.Fprintf(&buf, "\t%s := peg.NewRule(%q)\n", ids[stmt.Ident.Name], stmt.Ident.Name)
 	}
 	fmt.Fprintln(&buf, "")
 
+	annotated := false
+	for _, stmt := range prog.Stmts {
+		for _, a := range stmt.Annotations {
+			switch a.Name {
+			case "memo":
+				fmt.Fprintf(&buf, "\t%s.Memo()\n", ids[stmt.Ident.Name])
+			case "nomemo":
+				fmt.Fprintf(&buf, "\t%s.NoMemo()\n", ids[stmt.Ident.Name])
+			}
+			annotated = true
+		}
+		if stmt.Label != "" {
+			fmt.Fprintf(&buf, "\t%s.SetDisplayName(%q)\n", ids[stmt.Ident.Name], stmt.Label)
+			annotated = true
+		}
+	}
+	if annotated {
+		fmt.Fprintln(&buf, "")
+	}
+
 	for _, stmt := range prog.Stmts {
-		fmt.Fprintf(&buf, "\t%s.Define(\n", stmt.Ident.Name)
-		GenerateCodeExpr(&buf, stmt.Expr)
+		GenerateCodeDoc(&buf, stmt.Doc)
+		fmt.Fprintf(&buf, "\t%s.Define(\n", ids[stmt.Ident.Name])
+		GenerateCodeExpr(&buf, stmt.Expr, ids)
 		fmt.Fprintf(&buf, ")\n")
 	}
 
-	fmt.Fprintf(&buf, "\treturn %s\n", prog.Stmts[0].Ident.Name)
+	fmt.Fprintf(&buf, "\treturn %s\n", ids[prog.Stmts[0].Ident.Name])
 
 	fmt.Fprintln(&buf, "}")
 
 	return format.Source(buf.Bytes())
 }
 
-func GenerateCodeExpr(buf *bytes.Buffer, expr Expr) error {
+// generateOptimized writes the body of a function that builds the grammar
+// of prog as peg.Optimize returns it, so that the optimization pass does
+// not run when the function is called.
+func generateOptimized(buf *bytes.Buffer, prog *ast.Program, ids map[string]string) error {
+	g, err := peg.BuildGrammar(prog)
+	if err != nil {
+		return err
+	}
+	return peg.WriteGo(buf, peg.Optimize(g.Start()), func(name string) string {
+		return ids[name]
+	})
+}
+
+// GenerateCodeDoc writes the documentation of a rule as Go comments.
+func GenerateCodeDoc(buf *bytes.Buffer, doc string) {
+	if doc == "" {
+		return
+	}
+	for _, line := range strings.Split(doc, "\n") {
+		if line == "" {
+			fmt.Fprintln(buf, "//")
+		} else {
+			fmt.Fprintf(buf, "// %s\n", line)
+		}
+	}
+}
+
+// goIdents maps the rule names of prog to unique Go identifiers for their
+// variables. Names that can be used as they are keep their name, the
+// others are mangled by goIdent and numbered if the result is taken.
+func goIdents(prog *ast.Program) map[string]string {
+	ids := make(map[string]string)
+	used := make(map[string]bool)
+	for _, stmt := range prog.Stmts {
+		name := stmt.Ident.Name
+		if token.IsIdentifier(name) && !reservedIdent(name) {
+			ids[name] = name
+			used[name] = true
+		}
+	}
+	for _, stmt := range prog.Stmts {
+		name := stmt.Ident.Name
+		if _, ok := ids[name]; ok {
+			continue
+		}
+		base := goIdent(name)
+		id := base
+		for n := 2; used[id]; n++ {
+			id = fmt.Sprintf("%s_%d", base, n)
+		}
+		ids[name] = id
+		used[id] = true
+	}
+	return ids
+}
+
+// goIdent turns a rule name into a Go identifier: a hyphen capitalizes the
+// letter after it, as in decOctet for dec-octet, and reserved names get a
+// trailing underscore.
+func goIdent(name string) string {
+	var sb strings.Builder
+	upper := false
+	for _, ch := range name {
+		switch {
+		case ch == '-':
+			upper = true
+		case upper:
+			sb.WriteRune(unicode.ToUpper(ch))
+			upper = false
+		default:
+			sb.WriteRune(ch)
+		}
+	}
+	id := sb.String()
+	if reservedIdent(id) {
+		id += "_"
+	}
+	return id
+}
+
+// reservedIdent reports whether a rule variable cannot be named id: Go
+// keywords, the blank identifier and the name of the peg package, which
+// the generated code uses.
+func reservedIdent(id string) bool {
+	return token.IsKeyword(id) || id == "_" || id == "peg"
+}
+
+func GenerateCodeExpr(buf *bytes.Buffer, expr ast.Expr, ids map[string]string) error {
 	switch expr := expr.(type) {
-	case *ChoiceExpr:
+	case *ast.ChoiceExpr:
 		fmt.Fprintln(buf, "peg.NewChoice(")
 		for _, child := range expr.Exprs {
-			GenerateCodeExpr(buf, child)
+			GenerateCodeExpr(buf, child, ids)
 		}
 		fmt.Fprintln(buf, "),")
-	case *SequenceExpr:
+	case *ast.SequenceExpr:
 		fmt.Fprintln(buf, "peg.NewSequence(")
 		for _, child := range expr.Exprs {
-			GenerateCodeExpr(buf, child)
+			GenerateCodeExpr(buf, child, ids)
 		}
 		fmt.Fprintln(buf, "),")
-	case *ZeroOrMoreExpr:
+	case *ast.ZeroOrMoreExpr:
 		fmt.Fprintln(buf, "peg.NewZeroOrMore(")
-		GenerateCodeExpr(buf, expr.Expr)
+		GenerateCodeExpr(buf, expr.Expr, ids)
 		fmt.Fprintln(buf, "),")
-	case *OneOrMoreExpr:
+	case *ast.OneOrMoreExpr:
 		fmt.Fprintln(buf, "peg.NewOneOrMore(")
-		GenerateCodeExpr(buf, expr.Expr)
+		GenerateCodeExpr(buf, expr.Expr, ids)
 		fmt.Fprintln(buf, "),")
-	case *RepeatExpr:
+	case *ast.RepeatExpr:
 		fmt.Fprintln(buf, "peg.NewRepeat(")
-		GenerateCodeExpr(buf, expr.Expr)
+		GenerateCodeExpr(buf, expr.Expr, ids)
 		GenerateCodeLimit(buf, &expr.Limit)
 		fmt.Fprintln(buf, "),")
-	case *OptionalExpr:
+	case *ast.OptionalExpr:
 		fmt.Fprintln(buf, "peg.NewOptional(")
-		GenerateCodeExpr(buf, expr.Expr)
+		GenerateCodeExpr(buf, expr.Expr, ids)
 		fmt.Fprintln(buf, "),")
-	case *AndExpr:
+	case *ast.TagExpr:
+		fmt.Fprintf(buf, "peg.NewTag(%q,\n", expr.Name)
+		GenerateCodeExpr(buf, expr.Expr, ids)
+		fmt.Fprintln(buf, "),")
+	case *ast.AndExpr:
 		fmt.Fprintln(buf, "peg.NewAnd(")
-		GenerateCodeExpr(buf, expr.Expr)
+		GenerateCodeExpr(buf, expr.Expr, ids)
 		fmt.Fprintln(buf, "),")
-	case *NotExpr:
+	case *ast.NotExpr:
 		fmt.Fprintln(buf, "peg.NewNot(")
-		GenerateCodeExpr(buf, expr.Expr)
+		GenerateCodeExpr(buf, expr.Expr, ids)
 		fmt.Fprintln(buf, "),")
-	case *Charclass:
+	case *ast.Charclass:
 		fmt.Fprintln(buf, "peg.NewCharclass(")
 		if expr.Invert {
 			fmt.Fprintln(buf, "peg.RuneInvert{")
@@ -86,15 +212,19 @@ func GenerateCodeExpr(buf *bytes.Buffer, expr Expr) error {
 			GenerateCodeCharRange(buf, expr.Set)
 		}
 		fmt.Fprintln(buf, "),")
-	case *Literal:
+	case *ast.Literal:
 		fmt.Fprintln(buf, "peg.NewLiteral(")
 		fmt.Fprintf(buf, "%q,\n", expr.Text)
 		fmt.Fprintln(buf, "),")
-	case *Ident:
-		fmt.Fprintf(buf, "%s,\n", expr.Name)
-	case *Any:
+	case *ast.Ident:
+		id, ok := ids[expr.Name]
+		if !ok {
+			id = goIdent(expr.Name)
+		}
+		fmt.Fprintf(buf, "%s,\n", id)
+	case *ast.Any:
 		fmt.Fprintln(buf, "peg.Any,")
-	case *EOT:
+	case *ast.EOT:
 		fmt.Fprintln(buf, "peg.EOT,")
 	default:
 		return fmt.Errorf("unknown type: %T", expr)
@@ -102,7 +232,7 @@ func GenerateCodeExpr(buf *bytes.Buffer, expr Expr) error {
 	return nil
 }
 
-func GenerateCodeCharRange(buf *bytes.Buffer, set []CharRange) error {
+func GenerateCodeCharRange(buf *bytes.Buffer, set []ast.CharRange) error {
 	if len(set) == 1 {
 		r := set[0]
 		if r.Lower == r.Upper {
@@ -124,7 +254,7 @@ func GenerateCodeCharRange(buf *bytes.Buffer, set []CharRange) error {
 	return nil
 }
 
-func GenerateCodeLimit(buf *bytes.Buffer, l *Limit) error {
+func GenerateCodeLimit(buf *bytes.Buffer, l *ast.Limit) error {
 	switch {
 	case l.LowerValid && l.UpperValid:
 		fmt.Fprintf(buf, "peg.NewLimit(%v, %v),\n", l.Lower, l.Upper)
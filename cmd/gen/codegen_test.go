@@ -0,0 +1,155 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"testing"
+
+	"github.com/khirono/go-peg"
+)
+
+func TestGenerateCodeIdents(t *testing.T) {
+	prog, err := peg.ParseGrammar("names.peg", `
+ipv4-addr <- dec-octet "." dec-octet EOT / range / decOctet / peg / número / _ / type-
+dec-octet <- [0-9]+
+decOctet <- "x"
+range <- "r"
+peg <- "p"
+número <- "n"
+_ <- "u"
+type- <- "t"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := GenerateCode("main", "NewGrammar", prog, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), "grammar.go", code, 0)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, code)
+	}
+
+	// the variables of the rules are found from their peg.NewRule calls
+	got := make(map[string]string)
+	ast.Inspect(f, func(n ast.Node) bool {
+		as, ok := n.(*ast.AssignStmt)
+		if !ok || as.Tok != token.DEFINE {
+			return true
+		}
+		call := as.Rhs[0].(*ast.CallExpr)
+		name, err := strconv.Unquote(call.Args[0].(*ast.BasicLit).Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[name] = as.Lhs[0].(*ast.Ident).Name
+		return true
+	})
+	want := map[string]string{
+		"ipv4-addr": "ipv4Addr",
+		"dec-octet": "decOctet_2",
+		"decOctet":  "decOctet",
+		"range":     "range_",
+		"peg":       "peg_",
+		"número":    "número",
+		"_":         "__",
+		"type-":     "type_",
+	}
+	for name, id := range want {
+		if got[name] != id {
+			t.Errorf("%v: want variable %v; but got %q", name, id, got[name])
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("want %v rules; but got %v", len(want), got)
+	}
+}
+
+func TestGenerateCodeOptimized(t *testing.T) {
+	prog, err := peg.ParseGrammar("keyword.peg", `
+# keyword is the start rule
+keyword <- ("if" / "in" / "for") !alnum / hex{2,} / "'" [^a-z]
+alnum <- [a-z] / digit
+@nomemo
+hex "hex digit" <- digit / [a-f] / [A-F]
+digit <- [0-9]
+unused <- "u"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := GenerateCode("main", "NewGrammar", prog, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `// Code generated by gen; DO NOT EDIT.
+
+package main
+
+import (
+	"github.com/khirono/go-peg"
+)
+
+func NewGrammar() peg.Expr {
+	keyword := peg.NewRule("keyword")
+	alnum := peg.NewRule("alnum")
+	hex := peg.NewRule("hex")
+
+	hex.NoMemo()
+	hex.SetDisplayName("hex digit")
+
+	keyword.Define(
+		peg.NewChoice(
+			peg.NewSequence(
+				peg.NewLiteralSet(
+					"if",
+					"in",
+					"for",
+				),
+				peg.NewNot(
+					alnum,
+				),
+			),
+			peg.NewRepeat(
+				hex,
+				peg.NewLimitLower(2),
+			),
+			peg.NewSequence(
+				peg.NewLiteral("'"),
+				peg.NewCharclass(
+					peg.RuneInvert{
+						S: peg.RuneUnion{
+							peg.RuneRange{97, 122},
+						},
+					},
+				),
+			),
+		),
+	)
+	alnum.Define(
+		peg.NewCharclass(
+			peg.RuneUnion{
+				peg.RuneRange{97, 122},
+				peg.RuneRange{48, 57},
+			},
+		),
+	)
+	hex.Define(
+		peg.NewCharclass(
+			peg.RuneUnion{
+				peg.RuneRange{48, 57},
+				peg.RuneRange{97, 102},
+				peg.RuneRange{65, 70},
+			},
+		),
+	)
+	return keyword
+}
+`
+	if string(code) != want {
+		t.Errorf("want\n%s\nbut got\n%s", want, code)
+	}
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/khirono/go-peg"
+)
+
+const debugHelp = `commands:
+  s, step          step to the next rule call or return
+  n, next          step over the current rule call
+  o, out           run until the current rule returns
+  c, continue      run until a breakpoint or the end of the parse
+  b RULE | @OFF    break when RULE is called, or when a rule is called at OFF
+  b                list the breakpoints
+  d [N]            delete breakpoint N, or all of them
+  bt               show the rule stack
+  p, pos           show the current event and position
+  m [OFF]          show the memo table, or its entries at OFF
+  r, rewind [N]    go back N events (1 by default)
+  restart          go back to the start of the parse
+  q, quit          quit
+An empty line repeats the last command.
+`
+
+// debugMain runs "gen debug grammar.peg input.txt".
+func debugMain(args []string) int {
+	if len(args) != 2 {
+		fmt.Println("usage: gen debug grammar.peg input.txt")
+		return 1
+	}
+	prog, err := LoadFile(args[0])
+	if err != nil {
+		printLoadError(err)
+		return 1
+	}
+	if !checkProgram(prog) {
+		return 1
+	}
+	g, err := peg.BuildGrammar(prog)
+	if err != nil {
+		printLoadError(err)
+		return 1
+	}
+	data, err := os.ReadFile(args[1])
+	if err != nil {
+		fmt.Printf("Read Error: %v\n", err)
+		return 1
+	}
+	d := NewDebugger(g, string(data), os.Stdin, os.Stdout)
+	if err := d.Run(); err != nil {
+		fmt.Printf("Debug Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// errAborted stops a parse that the debugger no longer follows.
+var errAborted = errors.New("parse aborted")
+
+// debugStep is an event of the parse, or its end if done is set.
+type debugStep struct {
+	ev    peg.TraceEvent
+	enter bool
+	done  bool
+	ok    bool
+}
+
+// debugRun is a parse running in its own goroutine, which waits at every
+// rule event until the debugger resumes or aborts it. The scanner may be
+// read while the parse waits.
+type debugRun struct {
+	scan    *peg.Scanner
+	steps   chan debugStep
+	resume  chan bool
+	waiting bool
+}
+
+func startDebugRun(g peg.Expr, text string) *debugRun {
+	r := &debugRun{
+		steps:  make(chan debugStep),
+		resume: make(chan bool),
+	}
+	r.scan = peg.NewScanner(text, peg.WithTracer(r))
+	go func() {
+		defer func() {
+			if err := recover(); err != nil && err != errAborted {
+				panic(err)
+			}
+		}()
+		_, ok := g.Parse(r.scan)
+		r.steps <- debugStep{done: true, ok: ok}
+	}()
+	return r
+}
+
+func (r *debugRun) Enter(ev peg.TraceEvent) {
+	r.pause(debugStep{ev: ev, enter: true})
+}
+
+func (r *debugRun) Exit(ev peg.TraceEvent) {
+	r.pause(debugStep{ev: ev})
+}
+
+func (r *debugRun) pause(s debugStep) {
+	r.steps <- s
+	if !<-r.resume {
+		panic(errAborted)
+	}
+}
+
+func (r *debugRun) next() debugStep {
+	if r.waiting {
+		r.resume <- true
+	}
+	s := <-r.steps
+	r.waiting = !s.done
+	return s
+}
+
+func (r *debugRun) stop() {
+	if r.waiting {
+		r.resume <- false
+		r.waiting = false
+	}
+}
+
+// breakpoint stops at calls of a rule, or at calls at an offset if rule is
+// empty.
+type breakpoint struct {
+	rule string
+	pos  int
+}
+
+func (b breakpoint) String() string {
+	if b.rule != "" {
+		return b.rule
+	}
+	return fmt.Sprintf("@%d", b.pos)
+}
+
+// Debugger steps through the rule calls of a parse. Parses only run
+// forward, so it rewinds by parsing again up to an earlier event.
+type Debugger struct {
+	expr   peg.Expr
+	text   string
+	in     *bufio.Scanner
+	out    io.Writer
+	run    *debugRun
+	index  int
+	cur    debugStep
+	stack  []peg.TraceEvent
+	breaks []breakpoint
+}
+
+func NewDebugger(expr peg.Expr, text string, in io.Reader, out io.Writer) *Debugger {
+	d := new(Debugger)
+	d.expr = expr
+	d.text = text
+	d.in = bufio.NewScanner(in)
+	d.out = out
+	return d
+}
+
+// Run reads commands until quit or the end of the input.
+func (d *Debugger) Run() error {
+	d.restart()
+	d.advance()
+	d.show()
+	defer d.run.stop()
+	last := ""
+	for {
+		fmt.Fprint(d.out, "(peg) ")
+		if !d.in.Scan() {
+			fmt.Fprintln(d.out)
+			return d.in.Err()
+		}
+		line := strings.TrimSpace(d.in.Text())
+		if line == "" {
+			line = last
+		}
+		last = line
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "q" || fields[0] == "quit" {
+			return nil
+		}
+		d.command(fields[0], fields[1:])
+	}
+}
+
+func (d *Debugger) command(cmd string, args []string) {
+	switch cmd {
+	case "s", "step":
+		d.advance()
+		d.show()
+	case "n", "next":
+		if d.cur.enter {
+			depth := d.cur.ev.Depth
+			d.runUntil(func(s debugStep) bool {
+				return !s.enter && s.ev.Depth == depth
+			})
+		} else {
+			d.advance()
+		}
+		d.show()
+	case "o", "out":
+		depth := len(d.stack) - 1
+		if !d.cur.enter {
+			// the rule returning now is still on the stack
+			depth--
+		}
+		d.runUntil(func(s debugStep) bool {
+			return !s.enter && s.ev.Depth == depth
+		})
+		d.show()
+	case "c", "continue":
+		d.runUntil(func(debugStep) bool { return false })
+		d.show()
+	case "b", "break":
+		d.setBreak(args)
+	case "d", "delete":
+		d.deleteBreak(args)
+	case "bt":
+		for i := len(d.stack) - 1; i >= 0; i-- {
+			ev := d.stack[i]
+			fmt.Fprintf(d.out, "#%d %s @%d\n", i, ev.Name, ev.Pos)
+		}
+	case "p", "pos":
+		d.show()
+	case "m", "memo":
+		d.memo(args)
+	case "r", "rewind":
+		n := 1
+		if len(args) > 0 {
+			var err error
+			n, err = strconv.Atoi(args[0])
+			if err != nil || n < 1 {
+				fmt.Fprintf(d.out, "invalid count %q\n", args[0])
+				return
+			}
+		}
+		d.rewind(max(d.index-n, 1))
+		d.show()
+	case "restart":
+		d.rewind(1)
+		d.show()
+	case "h", "help":
+		fmt.Fprint(d.out, debugHelp)
+	default:
+		fmt.Fprintf(d.out, "unknown command %q, try help\n", cmd)
+	}
+}
+
+func (d *Debugger) restart() {
+	if d.run != nil {
+		d.run.stop()
+	}
+	d.run = startDebugRun(d.expr, d.text)
+	d.index = 0
+	d.cur = debugStep{}
+	d.stack = d.stack[:0]
+}
+
+// rewind parses again up to the event numbered index.
+func (d *Debugger) rewind(index int) {
+	d.restart()
+	for d.index < index && d.advance() {
+	}
+}
+
+// advance moves to the next event and reports whether there was one.
+func (d *Debugger) advance() bool {
+	if d.cur.done {
+		return false
+	}
+	// a returning rule stays on the stack until the next event
+	if d.index > 0 && !d.cur.enter {
+		d.stack = d.stack[:len(d.stack)-1]
+	}
+	d.cur = d.run.next()
+	d.index++
+	if d.cur.enter {
+		d.stack = append(d.stack, d.cur.ev)
+	}
+	return true
+}
+
+// runUntil advances until stop is true, a breakpoint is hit or the parse
+// ends.
+func (d *Debugger) runUntil(stop func(debugStep) bool) {
+	for d.advance() {
+		if stop(d.cur) {
+			return
+		}
+		if b, ok := d.hit(); ok {
+			fmt.Fprintf(d.out, "breakpoint %s\n", b)
+			return
+		}
+	}
+}
+
+func (d *Debugger) hit() (breakpoint, bool) {
+	if !d.cur.enter {
+		return breakpoint{}, false
+	}
+	for _, b := range d.breaks {
+		if b.rule == d.cur.ev.Name || b.rule == "" && b.pos == d.cur.ev.Pos {
+			return b, true
+		}
+	}
+	return breakpoint{}, false
+}
+
+func (d *Debugger) setBreak(args []string) {
+	if len(args) == 0 {
+		for i, b := range d.breaks {
+			fmt.Fprintf(d.out, "%d: %s\n", i+1, b)
+		}
+		return
+	}
+	b := breakpoint{rule: args[0]}
+	if off, ok := strings.CutPrefix(args[0], "@"); ok {
+		pos, err := strconv.Atoi(off)
+		if err != nil || pos < 0 || pos > len(d.text) {
+			fmt.Fprintf(d.out, "invalid offset %q\n", off)
+			return
+		}
+		b = breakpoint{pos: pos}
+	}
+	d.breaks = append(d.breaks, b)
+	fmt.Fprintf(d.out, "breakpoint %d: %s\n", len(d.breaks), b)
+}
+
+func (d *Debugger) deleteBreak(args []string) {
+	if len(args) == 0 {
+		d.breaks = nil
+		return
+	}
+	i, err := strconv.Atoi(args[0])
+	if err != nil || i < 1 || i > len(d.breaks) {
+		fmt.Fprintf(d.out, "no breakpoint %q\n", args[0])
+		return
+	}
+	d.breaks = append(d.breaks[:i-1], d.breaks[i:]...)
+}
+
+func (d *Debugger) memo(args []string) {
+	pos := -1
+	if len(args) > 0 {
+		var err error
+		pos, err = strconv.Atoi(args[0])
+		if err != nil {
+			fmt.Fprintf(d.out, "invalid offset %q\n", args[0])
+			return
+		}
+	}
+	type entry struct {
+		pos  int
+		name string
+		end  int
+	}
+	var entries []entry
+	d.run.scan.EachMemo(func(p int, name string, m peg.Memo) {
+		if pos < 0 || p == pos {
+			entries = append(entries, entry{p, name, m.Pos})
+		}
+	})
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].pos != entries[j].pos {
+			return entries[i].pos < entries[j].pos
+		}
+		return entries[i].name < entries[j].name
+	})
+	for _, e := range entries {
+		fmt.Fprintf(d.out, "@%d %s matched %d-%d\n", e.pos, e.name, e.pos, e.end)
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(d.out, "no memo entries")
+	}
+}
+
+// show prints the current event and its place in the input.
+func (d *Debugger) show() {
+	if d.cur.done {
+		if d.cur.ok {
+			fmt.Fprintf(d.out, "parse accepted %d bytes\n", d.run.scan.Pos)
+		} else {
+			fmt.Fprintf(d.out, "parse rejected: %v\n", peg.Diagnose(d.expr, d.run.scan, ""))
+		}
+		return
+	}
+	ev := d.cur.ev
+	end := ev.Pos
+	var what string
+	switch {
+	case d.cur.enter:
+		what = fmt.Sprintf("> %s @%d", ev.Name, ev.Pos)
+	case ev.OK:
+		what = fmt.Sprintf("< %s @%d matched %d-%d", ev.Name, ev.Pos, ev.Pos, ev.End)
+		end = ev.End
+	default:
+		what = fmt.Sprintf("< %s @%d failed", ev.Name, ev.Pos)
+	}
+	if ev.Memo == peg.MemoHit {
+		what += " (memo hit)"
+	}
+	fmt.Fprintf(d.out, "[%d] %s\n", d.index, what)
+	d.showInput(ev.Pos, end)
+}
+
+// showInput prints the line of the input holding pos with a mark under
+// the bytes from pos to end.
+func (d *Debugger) showInput(pos, end int) {
+	bol := strings.LastIndexByte(d.text[:pos], '\n') + 1
+	eol := strings.IndexByte(d.text[pos:], '\n')
+	if eol < 0 {
+		eol = len(d.text)
+	} else {
+		eol += pos
+	}
+	var pad strings.Builder
+	for _, ch := range d.text[bol:pos] {
+		if ch == '\t' {
+			pad.WriteByte('\t')
+		} else {
+			pad.WriteByte(' ')
+		}
+	}
+	width := max(utf8.RuneCountInString(d.text[pos:min(end, eol)]), 1)
+	fmt.Fprintf(d.out, "  %s\n  %s^%s\n", d.text[bol:eol], pad.String(), strings.Repeat("~", width-1))
+}
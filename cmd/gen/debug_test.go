@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/khirono/go-peg"
+)
+
+func TestDebugger(t *testing.T) {
+	prog, err := LoadFile("../../examples/codegen-ipv6/ipv6addr.peg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := peg.BuildGrammar(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := strings.Join([]string{
+		"b decOctet",
+		"c",
+		"bt",
+		"n",
+		"r 5",
+		"o",
+		"m 7",
+		"d",
+		"c",
+		"q",
+	}, "\n")
+	var sb strings.Builder
+	d := NewDebugger(g, "::ffff:192.0.2.128", strings.NewReader(script), &sb)
+	if err := d.Run(); err != nil {
+		t.Fatal(err)
+	}
+	out := sb.String()
+	for _, want := range []string{
+		"breakpoint 1: decOctet\n",
+		"breakpoint decOctet\n[104] > decOctet @7\n  ::ffff:192.0.2.128\n         ^\n",
+		"#3 decOctet @7\n#2 IPv4address @7\n#1 ls32 @7\n#0 IPv6address @0\n",
+		"[109] < decOctet @7 matched 7-10\n  ::ffff:192.0.2.128\n         ^~~\n",
+		"(peg) [104] > decOctet @7\n",
+		"(peg) @7 decOctet matched 7-10\n",
+		"parse accepted 18 bytes\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("want %q in\n%s", want, out)
+		}
+	}
+}
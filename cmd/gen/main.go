@@ -1,32 +1,52 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 
 	"github.com/khirono/go-peg"
+	"github.com/khirono/go-peg/ast"
 )
 
 func main() {
 	var outfile string
 	var pkgname string
 	var funcname string
+	var optimize bool
+	var check bool
 	flag.StringVar(&outfile, "outfile", "grammar.go", "output filename")
 	flag.StringVar(&pkgname, "pkgname", "main", "package name")
 	flag.StringVar(&funcname, "funcname", "NewGrammar", "function name")
+	flag.BoolVar(&optimize, "O", false, "generate the grammar as peg.Optimize returns it")
+	flag.BoolVar(&check, "check", false, "only check the grammar, do not generate code")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: gen [flags] grammar.peg")
+		fmt.Fprintln(flag.CommandLine.Output(), "       gen debug grammar.peg input.txt")
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 	if flag.NArg() < 1 {
-		flag.PrintDefaults()
+		flag.Usage()
 		os.Exit(1)
 	}
+	if flag.Arg(0) == "debug" {
+		os.Exit(debugMain(flag.Args()[1:]))
+	}
 	infile := flag.Arg(0)
 	prog, err := LoadFile(infile)
 	if err != nil {
-		fmt.Printf("Load Error: %v\n", err)
+		printLoadError(err)
+		os.Exit(1)
+	}
+	if !checkProgram(prog) {
 		os.Exit(1)
 	}
-	code, err := GenerateCode(pkgname, funcname, prog)
+	if check {
+		return
+	}
+	code, err := GenerateCode(pkgname, funcname, prog, optimize)
 	if err != nil {
 		fmt.Printf("Generate Error: %v\n", err)
 		os.Exit(1)
@@ -38,18 +58,37 @@ func main() {
 	}
 }
 
-func LoadFile(filename string) (*Program, error) {
+func LoadFile(filename string) (*ast.Program, error) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, err
 	}
-	scan := peg.NewScanner(string(data))
-	g := NewPEGGrammar()
-	t, ok := g.Parse(scan)
-	if !ok {
-		fmt.Printf("longest: %q\n", scan.Longest())
-		return nil, fmt.Errorf("not accepted")
+	return peg.ParseGrammar(filename, string(data))
+}
+
+func printLoadError(err error) {
+	var d *peg.Diagnostic
+	if errors.As(err, &d) {
+		d.Render(os.Stdout, isTerminal(os.Stdout))
+	} else {
+		fmt.Printf("Load Error: %v\n", err)
+	}
+}
+
+// checkProgram prints the problems found by peg.Check and reports whether
+// none of them is an error.
+func checkProgram(prog *ast.Program) bool {
+	ok := true
+	for _, d := range peg.Check(prog) {
+		d.Render(os.Stdout, isTerminal(os.Stdout))
+		if d.Severity == peg.SeverityError {
+			ok = false
+		}
 	}
-	b := NewASTBuilder(scan.Text)
-	return b.Build(t)
+	return ok
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
 }
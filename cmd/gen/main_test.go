@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/khirono/go-peg"
+)
+
+func TestLoadFileErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{
+			src: "a <- b\nb <- \"x\" /\n",
+			want: `big.peg:3:1: error: expected expression, found end of input
+3 | 
+  | ^
+`,
+		},
+		{
+			src: "a <- (b # group\n",
+			want: `big.peg:2:1: error: expected expression, "/" or ")", found end of input
+2 | 
+  | ^
+`,
+		},
+		{
+			src: "a <- b{2,\n",
+			want: `big.peg:2:1: error: expected number or "}", found end of input
+2 | 
+  | ^
+`,
+		},
+		{
+			src: "a <- b )\n",
+			want: `big.peg:1:8: error: expected expression or "/", found ')'
+1 | a <- b )
+  |        ^
+`,
+		},
+		{
+			src: "@memo\n",
+			want: `big.peg:2:1: error: expected annotation or identifier, found end of input
+2 | 
+  | ^
+`,
+		},
+	}
+	dir := t.TempDir()
+	for _, tc := range tests {
+		filename := filepath.Join(dir, "big.peg")
+		if err := os.WriteFile(filename, []byte(tc.src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := LoadFile(filename)
+		var d *peg.Diagnostic
+		if !errors.As(err, &d) {
+			t.Fatalf("%q: want a diagnostic; but got %v", tc.src, err)
+		}
+		d.Filename = filepath.Base(d.Filename)
+		var sb strings.Builder
+		d.Render(&sb, false)
+		if sb.String() != tc.want {
+			t.Errorf("%q: want\n%s\nbut got\n%s", tc.src, tc.want, sb.String())
+		}
+	}
+}
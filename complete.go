@@ -0,0 +1,211 @@
+package peg
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ExpectKind tells what an Expected item is.
+type ExpectKind int
+
+const (
+	ExpectLiteral ExpectKind = iota
+	ExpectClass
+	ExpectRule
+	// ExpectLabel is the message of a rule display name or an Expect.
+	ExpectLabel
+)
+
+// Expected is an item that can come next at the end of a prefix.
+type Expected struct {
+	Kind ExpectKind
+	// Pos is where the item starts. A literal starts before the end of
+	// the prefix when the prefix already holds its first bytes.
+	Pos int
+	// Text is the literal, the name of the rule or the label.
+	Text string
+	// Ranges are the runes accepted by a charclass.
+	Ranges []RuneRange
+	// Rule is, for a literal or a charclass, the outermost rule called at
+	// Pos while it was tried, if any. Label is the outermost label there,
+	// a display name or the message of an Expect, if Pos is the end of the
+	// input.
+	Rule  string
+	Label string
+}
+
+func (e Expected) String() string {
+	switch e.Kind {
+	case ExpectLiteral:
+		return fmt.Sprintf("%q", e.Text)
+	case ExpectClass:
+		ranges := e.Ranges
+		var sb strings.Builder
+		sb.WriteByte('[')
+		// classes that accept most runes read better inverted
+		if n := len(ranges); n > 0 && ranges[0][0] == 0 && ranges[n-1][1] == utf8.MaxRune {
+			if n == 1 {
+				return "any character"
+			}
+			var set runeSet
+			for _, r := range ranges {
+				set = append(set, runeInterval{r[0], r[1]})
+			}
+			ranges = ranges[:0:0]
+			for _, r := range set.invert() {
+				ranges = append(ranges, RuneRange{r.lo, r.hi})
+			}
+			sb.WriteByte('^')
+		}
+		for _, r := range ranges {
+			if r[0] == r[1] {
+				fmt.Fprintf(&sb, "%q", r[0])
+			} else {
+				fmt.Fprintf(&sb, "%q-%q", r[0], r[1])
+			}
+		}
+		sb.WriteByte(']')
+		return sb.String()
+	default:
+		return e.Text
+	}
+}
+
+// Message returns the label of the item if it has one, otherwise the item
+// itself.
+func (e Expected) Message() string {
+	if e.Label != "" {
+		return e.Label
+	}
+	return e.String()
+}
+
+// Completion is the result of Complete.
+type Completion struct {
+	// Accepted is true if the grammar accepts the prefix as it is.
+	Accepted bool
+	// Viable is true if the prefix is accepted or some item can come
+	// next, so that it may be extended to an accepted input.
+	Viable bool
+	// Expected lists the items that can come next, in the order the
+	// grammar tries them: the literals and charclasses that reached the
+	// end of the prefix, and the rules and labels starting where they
+	// start.
+	Expected []Expected
+}
+
+// Complete parses prefix with expr and reports what can come next at its
+// end. An item is expected when the parse tries it at the end of the
+// input, or when a literal matches up to there. Items tried under a Not
+// predicate are left out, since they are what must not come next, and so
+// are those tried where a hidden rule starts.
+//
+// The parse runs without memoization, so that every attempt at the end is
+// seen. Viable is exact for grammars without predicates; predicates that
+// look past the end of the prefix are assumed to be satisfiable.
+func Complete(expr Expr, prefix string, opts ...ScannerOption) *Completion {
+	scan := NewScanner(prefix, opts...)
+	scan.expect = &expectations{
+		seen: make(map[string]bool),
+		end:  len(prefix),
+	}
+	_, ok := expr.Parse(scan)
+	c := new(Completion)
+	c.Accepted = ok && scan.err == nil
+	c.Expected = scan.expect.list
+	c.Viable = c.Accepted || len(c.Expected) > 0
+	return c
+}
+
+// expectations collects the items tried at the end of the input.
+type expectations struct {
+	list  []Expected
+	seen  map[string]bool
+	calls []call
+	// end is the end of the input, where the parse fails.
+	end int
+	// neg counts the Not predicates being evaluated.
+	neg int
+}
+
+// call is a rule or a label being evaluated from pos.
+type call struct {
+	rule  *Rule
+	label string
+	pos   int
+}
+
+func (x *expectations) push(r *Rule, label string, pos int) {
+	x.calls = append(x.calls, call{r, label, pos})
+}
+
+func (x *expectations) pop() {
+	x.calls = x.calls[:len(x.calls)-1]
+}
+
+func (x *expectations) add(e Expected) {
+	key := fmt.Sprint(e.Kind, e.Pos, e.Text, e.Ranges)
+	if x.seen[key] {
+		return
+	}
+	x.seen[key] = true
+	x.list = append(x.list, e)
+}
+
+// terminal records e together with the rules being called at its start,
+// unless a hidden rule is called there. The outermost label replaces e in
+// messages only if it starts at the end of the input, where the parse
+// fails, and not before a literal that matched up to there.
+func (x *expectations) terminal(e Expected) {
+	if x.neg > 0 {
+		return
+	}
+	for _, c := range x.calls {
+		if c.rule != nil && c.rule.hidden && c.pos == e.Pos {
+			return
+		}
+	}
+	for _, c := range x.calls {
+		if c.pos != e.Pos {
+			continue
+		}
+		if c.rule != nil {
+			if e.Rule == "" {
+				e.Rule = c.rule.DisplayName()
+			}
+			x.add(Expected{Kind: ExpectRule, Pos: c.pos, Text: c.rule.DisplayName()})
+		}
+		if c.label != "" {
+			if e.Label == "" && c.pos == x.end {
+				e.Label = c.label
+			}
+			x.add(Expected{Kind: ExpectLabel, Pos: c.pos, Text: c.label})
+		}
+	}
+	x.add(e)
+}
+
+// expectLiteral records a literal starting at pos whose match reached the
+// end of the input.
+func (s *Scanner) expectLiteral(pos int, text string) {
+	if s.expect != nil {
+		s.expect.terminal(Expected{Kind: ExpectLiteral, Pos: pos, Text: text})
+	}
+}
+
+// expectClass records a charclass tried at the end of the input.
+func (s *Scanner) expectClass(set RuneSubset) {
+	if s.expect == nil {
+		return
+	}
+	rs, ok := newRuneSet(set)
+	if !ok {
+		return
+	}
+	ranges := make([]RuneRange, len(rs))
+	for i, r := range rs {
+		ranges[i] = RuneRange{r.lo, r.hi}
+	}
+	s.expect.terminal(Expected{Kind: ExpectClass, Pos: s.Pos, Ranges: ranges})
+}
@@ -0,0 +1,122 @@
+package peg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		accepted bool
+		viable   bool
+		want     string
+	}{
+		{
+			prefix: "192.168.",
+			viable: true,
+			want:   `oct "25" "2" "1" ['1'-'9'] ['0'-'9']`,
+		},
+		{
+			prefix: "192.168.30.2",
+			viable: true,
+			want:   `oct "25" ['0'-'4'] ['0'-'9'] "/"`,
+		},
+		{
+			prefix: "192.168.30.254/",
+			viable: true,
+			want:   `mask "3" ['1'-'2'] ['0'-'9']`,
+		},
+		{
+			prefix:   "192.168.30.254/2",
+			accepted: true,
+			viable:   true,
+			want:     `['0'-'9']`,
+		},
+		{
+			prefix:   "192.168.30.254/24",
+			accepted: true,
+			viable:   true,
+		},
+		{
+			prefix: "192.168.300",
+		},
+	}
+	g := newIPv4PrefixGrammar()
+	for _, tc := range tests {
+		t.Run(tc.prefix, func(t *testing.T) {
+			c := Complete(g, tc.prefix)
+			var items []string
+			for _, e := range c.Expected {
+				items = append(items, e.String())
+			}
+			got := strings.Join(items, " ")
+			if c.Accepted != tc.accepted || c.Viable != tc.viable || got != tc.want {
+				t.Errorf("want %v %v %v; but got %v %v %v", tc.accepted, tc.viable, tc.want, c.Accepted, c.Viable, got)
+			}
+		})
+	}
+}
+
+func TestCompleteEngines(t *testing.T) {
+	g := newIPv4PrefixGrammar()
+	vm, err := Compile(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []Expr{Optimize(g), OptimizeRegular(g), vm} {
+		for _, prefix := range []string{"1", "192.168.", "10.0.0.1/3"} {
+			want := Complete(g, prefix)
+			got := Complete(e, prefix)
+			if got.Viable != want.Viable || len(got.Expected) == 0 != (len(want.Expected) == 0) {
+				t.Errorf("%T %q: want %v; but got %v", e, prefix, want.Expected, got.Expected)
+			}
+		}
+	}
+}
+
+func TestCompleteHidden(t *testing.T) {
+	list := NewRule("hiddenList")
+	sp := NewRule("hiddenSpace")
+	blank := NewRule("hiddenBlank")
+	sp.Hide()
+	blank.Hide()
+
+	// hiddenList <- "a" hiddenSpace ("," hiddenSpace "a" hiddenSpace)* EOT
+	list.Define(NewSequence(
+		NewLiteral("a"), sp,
+		NewZeroOrMore(NewSequence(NewLiteral(","), sp, NewLiteral("a"), sp)),
+		EOT,
+	))
+	// hiddenSpace <- hiddenBlank*
+	sp.Define(NewZeroOrMore(blank))
+	// hiddenBlank <- " " / "(*" (!"*)" .)* "*)"
+	blank.Define(NewChoice(
+		NewLiteral(" "),
+		NewSequence(
+			NewLiteral("(*"),
+			NewZeroOrMore(NewSequence(NewNot(NewLiteral("*)")), Any)),
+			NewLiteral("*)"),
+		),
+	))
+
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{"a, ", `"a"`},
+		{"a ", `","`},
+		// the end of a comment that has started is still expected
+		{"a (* x", `any character "*)"`},
+	}
+	for _, tc := range tests {
+		c := Complete(list, tc.prefix)
+		var items []string
+		for _, e := range c.Expected {
+			items = append(items, e.String())
+		}
+		if got := strings.Join(items, " "); got != tc.want {
+			t.Errorf("%q: want %v; but got %v", tc.prefix, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,606 @@
+package peg
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf8"
+)
+
+var _ Expr = &DFA{}
+
+// dfaMaxStates bounds the size of the automata built by CompileDFA.
+const dfaMaxStates = 4096
+
+// DFA matches a regular expression with a deterministic automaton. It is
+// built by CompileDFA only when the PEG semantics of the expression are
+// those of the automaton: the expression then matches the longest prefix
+// of the input in its language.
+//
+// Parse returns a single tree spanning the match.
+type DFA struct {
+	expr Expr
+	// bounds[i] is the first rune of rune class i.
+	bounds []rune
+	ascii  [utf8.RuneSelf]int32
+	nclass int
+	// trans[q*nclass+c] is the next state, or -1 if no accepting state
+	// can be reached any more.
+	trans  []int32
+	accept []bool
+}
+
+// CompileDFA compiles expr into a DFA. It fails if expr uses predicates,
+// rules, tags or expressions of other packages, or if ordered choice or
+// greedy repetition would make the PEG differ from the automaton. Rules
+// and tags are left out since their trees carry tags, which a single tree
+// spanning the match cannot.
+func CompileDFA(expr Expr) (*DFA, error) {
+	re, err := toRegex(expr)
+	if err != nil {
+		return nil, err
+	}
+	var sets []runeSet
+	re.collect(&sets)
+	a := newAlphabet(sets)
+	if err := a.check(re); err != nil {
+		return nil, err
+	}
+	m, err := a.build(re)
+	if err != nil {
+		return nil, err
+	}
+	d := &DFA{
+		expr:   expr,
+		bounds: a.bounds,
+		nclass: len(a.bounds),
+		accept: m.accept,
+	}
+	for ch := rune(0); ch < utf8.RuneSelf; ch++ {
+		d.ascii[ch] = int32(a.class(ch))
+	}
+	d.trans = make([]int32, len(m.trans)*d.nclass)
+	for q, row := range m.trans {
+		for c, next := range row {
+			if next >= 0 && !m.live[next] {
+				next = -1
+			}
+			d.trans[q*d.nclass+c] = int32(next)
+		}
+	}
+	return d, nil
+}
+
+func (d *DFA) class(ch rune) int {
+	if ch < utf8.RuneSelf {
+		return int(d.ascii[ch])
+	}
+	return sort.Search(len(d.bounds), func(i int) bool {
+		return d.bounds[i] > ch
+	}) - 1
+}
+
+// run scans from scan.Pos and returns the end of the longest match.
+func (d *DFA) run(scan *Scanner) (int, bool) {
+	text := scan.Text
+	pos := scan.Pos
+	last := -1
+	q := int32(0)
+	if d.accept[0] {
+		last = pos
+	}
+	for {
+		ch, size := utf8.DecodeRuneInString(text[pos:])
+		scan.examineRune(pos, size)
+		if size == 0 {
+			break
+		}
+		q = d.trans[int(q)*d.nclass+d.class(ch)]
+		if q < 0 {
+			break
+		}
+		pos += size
+		if pos > scan.LPos {
+			scan.LPos = pos
+		}
+		if d.accept[q] {
+			last = pos
+		}
+	}
+	return last, last >= 0
+}
+
+func (d *DFA) Parse(scan *Scanner) (*Tree, bool) {
+	if scan.interpreted() {
+		return scan.parse(d.expr)
+	}
+	start := scan.Pos
+	end, ok := d.run(scan)
+	if !ok {
+		return nil, false
+	}
+	scan.Pos = end
+	t := scan.newTree(start)
+	t.End = end
+	return t, true
+}
+
+func (d *DFA) Match(scan *Scanner) bool {
+	if scan.interpreted() {
+		return scan.match(d.expr)
+	}
+	end, ok := d.run(scan)
+	if ok {
+		scan.Pos = end
+	}
+	return ok
+}
+
+// OptimizeRegular returns a copy of the grammar reachable from expr in
+// which the definitions of rules accepted by CompileDFA are replaced by
+// their DFA. Other rules, including those whose definitions call rules,
+// are kept as they are.
+func OptimizeRegular(expr Expr) Expr {
+	return rewrite(expr, func(r *Rule, body Expr) Expr {
+		switch r.expr.(type) {
+		case *Literal, *Charclass:
+			return body
+		}
+		d, err := CompileDFA(r.expr)
+		if err != nil {
+			return body
+		}
+		return d
+	})
+}
+
+func hasTag(e Expr, seen map[*Rule]bool) bool {
+	if _, ok := e.(*Tag); ok {
+		return true
+	}
+	if r, ok := e.(*Rule); ok {
+		if seen[r] {
+			return false
+		}
+		seen[r] = true
+	}
+	for _, c := range children(e) {
+		if hasTag(c, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+type regexKind int
+
+const (
+	reSet regexKind = iota
+	reSeq
+	reAlt
+	reRepeat
+)
+
+// regex is a regular expression with the structure of the PEG it comes
+// from, so that the PEG semantics can be checked on it.
+type regex struct {
+	kind  regexKind
+	set   runeSet
+	subs  []*regex
+	lower int
+	upper int // -1 for no upper bound
+}
+
+func toRegex(e Expr) (*regex, error) {
+	switch e := e.(type) {
+	case *Literal:
+		re := &regex{kind: reSeq}
+		for i := 0; i < len(e.text); i++ {
+			if e.text[i] >= utf8.RuneSelf {
+				return nil, fmt.Errorf("non-ASCII literal %q", e.text)
+			}
+			ch := rune(e.text[i])
+			re.subs = append(re.subs, &regex{kind: reSet, set: runeSet{{ch, ch}}})
+		}
+		return re, nil
+	case *Charclass:
+		set, ok := newRuneSet(e.set)
+		if !ok {
+			return nil, fmt.Errorf("unknown rune subset %T", e.set)
+		}
+		return &regex{kind: reSet, set: set}, nil
+	case *Sequence, *Choice:
+		kind := reSeq
+		if _, ok := e.(*Choice); ok {
+			kind = reAlt
+		}
+		re := &regex{kind: kind}
+		for _, c := range children(e) {
+			sub, err := toRegex(c)
+			if err != nil {
+				return nil, err
+			}
+			re.subs = append(re.subs, sub)
+		}
+		return re, nil
+	case *Repeat:
+		sub, err := toRegex(e.expr)
+		if err != nil {
+			return nil, err
+		}
+		re := &regex{kind: reRepeat, subs: []*regex{sub}, upper: -1}
+		if e.limit.lowervalid {
+			re.lower = e.limit.lower
+		}
+		if e.limit.uppervalid {
+			re.upper = e.limit.upper
+		}
+		if re.upper >= 0 && re.lower > re.upper {
+			return nil, fmt.Errorf("empty repetition")
+		}
+		return re, nil
+	case *Optional:
+		sub, err := toRegex(e.expr)
+		if err != nil {
+			return nil, err
+		}
+		return &regex{kind: reRepeat, subs: []*regex{sub}, upper: 1}, nil
+	case *Expect:
+		return toRegex(e.expr)
+	case *Tag:
+		return nil, fmt.Errorf("tag %v builds a tree", e.name)
+	case *Rule:
+		return nil, fmt.Errorf("rule %v builds a tree", e.name)
+	default:
+		return nil, fmt.Errorf("%T is not regular", e)
+	}
+}
+
+func (re *regex) collect(sets *[]runeSet) {
+	if re.kind == reSet {
+		*sets = append(*sets, re.set)
+	}
+	for _, sub := range re.subs {
+		sub.collect(sets)
+	}
+}
+
+// alphabet partitions the runes into classes that no set of the
+// expression distinguishes.
+type alphabet struct {
+	bounds []rune
+}
+
+func newAlphabet(sets []runeSet) *alphabet {
+	points := map[rune]bool{0: true}
+	for _, set := range sets {
+		for _, x := range set {
+			points[x.lo] = true
+			if x.hi < utf8.MaxRune {
+				points[x.hi+1] = true
+			}
+		}
+	}
+	a := new(alphabet)
+	for p := range points {
+		a.bounds = append(a.bounds, p)
+	}
+	sort.Slice(a.bounds, func(i, j int) bool {
+		return a.bounds[i] < a.bounds[j]
+	})
+	return a
+}
+
+func (a *alphabet) class(ch rune) int {
+	return sort.Search(len(a.bounds), func(i int) bool {
+		return a.bounds[i] > ch
+	}) - 1
+}
+
+// check verifies that the PEG semantics of re are those of its language:
+// every subexpression matches the longest prefix of the input in its
+// language.
+func (a *alphabet) check(re *regex) error {
+	for _, sub := range re.subs {
+		if err := a.check(sub); err != nil {
+			return err
+		}
+	}
+	switch re.kind {
+	case reSeq:
+		// a greedy prefix must not be able to stop earlier and let the
+		// next element start where it continued
+		for k := 1; k < len(re.subs); k++ {
+			prefix, err := a.build(&regex{kind: reSeq, subs: re.subs[:k]})
+			if err != nil {
+				return err
+			}
+			next, err := a.build(re.subs[k])
+			if err != nil {
+				return err
+			}
+			if prefix.extensions().overlaps(next.first()) {
+				return fmt.Errorf("sequence element %d can start where element %d continues", k, k-1)
+			}
+		}
+	case reAlt:
+		// an earlier alternative must not win with a shorter match than
+		// a later one could have
+		for k := 1; k < len(re.subs); k++ {
+			prefix, err := a.build(&regex{kind: reAlt, subs: re.subs[:k]})
+			if err != nil {
+				return err
+			}
+			next, err := a.build(re.subs[k])
+			if err != nil {
+				return err
+			}
+			if prefix.extendedBy(next) {
+				return fmt.Errorf("alternative %d extends an earlier alternative", k)
+			}
+		}
+	case reRepeat:
+		if re.upper == 1 && re.lower == 0 {
+			return nil
+		}
+		sub, err := a.build(re.subs[0])
+		if err != nil {
+			return err
+		}
+		if sub.accept[0] {
+			return fmt.Errorf("repetition of a nullable expression")
+		}
+		if sub.extensions().overlaps(sub.first()) {
+			return fmt.Errorf("repetition can restart where it continues")
+		}
+	}
+	return nil
+}
+
+// classSet is a set of rune classes.
+type classSet []bool
+
+func (s classSet) overlaps(t classSet) bool {
+	for c := range s {
+		if s[c] && t[c] {
+			return true
+		}
+	}
+	return false
+}
+
+// automaton is a DFA over rune classes; state 0 is the start state.
+type automaton struct {
+	trans  [][]int
+	accept []bool
+	live   []bool
+}
+
+// first returns the classes that can start a non-empty match.
+func (m *automaton) first() classSet {
+	s := make(classSet, len(m.trans[0]))
+	for c, q := range m.trans[0] {
+		s[c] = q >= 0 && m.live[q]
+	}
+	return s
+}
+
+// extensions returns the classes that can continue a match into a longer
+// one.
+func (m *automaton) extensions() classSet {
+	s := make(classSet, len(m.trans[0]))
+	for p := range m.trans {
+		if !m.accept[p] {
+			continue
+		}
+		for c, q := range m.trans[p] {
+			if q >= 0 && m.live[q] {
+				s[c] = true
+			}
+		}
+	}
+	return s
+}
+
+// extendedBy reports whether a string of n's language is a proper
+// extension of a string of m's language.
+func (m *automaton) extendedBy(n *automaton) bool {
+	type pair struct {
+		p, q  int
+		after bool
+	}
+	start := pair{0, 0, false}
+	seen := map[pair]bool{start: true}
+	queue := []pair{start}
+	for len(queue) > 0 {
+		x := queue[0]
+		queue = queue[1:]
+		if x.after && n.accept[x.q] {
+			return true
+		}
+		after := x.after || (x.p >= 0 && m.accept[x.p])
+		for c := range n.trans[x.q] {
+			q := n.trans[x.q][c]
+			if q < 0 || !n.live[q] {
+				continue
+			}
+			p := -1
+			if x.p >= 0 {
+				p = m.trans[x.p][c]
+			}
+			if !after && (p < 0 || !m.live[p]) {
+				continue
+			}
+			y := pair{p, q, after}
+			if after {
+				y.p = -1
+			}
+			if !seen[y] {
+				seen[y] = true
+				queue = append(queue, y)
+			}
+		}
+	}
+	return false
+}
+
+// nfa is a Thompson automaton; edges with a nil set are empty moves.
+type nfa struct {
+	edges [][]nfaEdge
+}
+
+type nfaEdge struct {
+	set runeSet
+	to  int
+}
+
+func (n *nfa) state() int {
+	n.edges = append(n.edges, nil)
+	return len(n.edges) - 1
+}
+
+func (n *nfa) edge(from, to int, set runeSet) {
+	n.edges[from] = append(n.edges[from], nfaEdge{set, to})
+}
+
+// fragment adds re between the new states it returns.
+func (n *nfa) fragment(re *regex) (int, int) {
+	in := n.state()
+	switch re.kind {
+	case reSet:
+		out := n.state()
+		n.edge(in, out, re.set)
+		return in, out
+	case reSeq:
+		cur := in
+		for _, sub := range re.subs {
+			s, e := n.fragment(sub)
+			n.edge(cur, s, nil)
+			cur = e
+		}
+		return in, cur
+	case reAlt:
+		out := n.state()
+		for _, sub := range re.subs {
+			s, e := n.fragment(sub)
+			n.edge(in, s, nil)
+			n.edge(e, out, nil)
+		}
+		return in, out
+	default:
+		cur := in
+		for i := 0; i < re.lower; i++ {
+			s, e := n.fragment(re.subs[0])
+			n.edge(cur, s, nil)
+			cur = e
+		}
+		out := n.state()
+		n.edge(cur, out, nil)
+		if re.upper < 0 {
+			s, e := n.fragment(re.subs[0])
+			n.edge(cur, s, nil)
+			n.edge(e, cur, nil)
+			return in, out
+		}
+		for i := re.lower; i < re.upper; i++ {
+			s, e := n.fragment(re.subs[0])
+			n.edge(cur, s, nil)
+			n.edge(e, out, nil)
+			cur = e
+		}
+		return in, out
+	}
+}
+
+func (n *nfa) closure(states []int) []int {
+	seen := make(map[int]bool)
+	var stack []int
+	for _, q := range states {
+		if !seen[q] {
+			seen[q] = true
+			stack = append(stack, q)
+		}
+	}
+	for len(stack) > 0 {
+		q := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, e := range n.edges[q] {
+			if e.set == nil && !seen[e.to] {
+				seen[e.to] = true
+				stack = append(stack, e.to)
+			}
+		}
+	}
+	list := make([]int, 0, len(seen))
+	for q := range seen {
+		list = append(list, q)
+	}
+	sort.Ints(list)
+	return list
+}
+
+// build determinizes re by subset construction.
+func (a *alphabet) build(re *regex) (*automaton, error) {
+	n := new(nfa)
+	in, out := n.fragment(re)
+	m := new(automaton)
+	ids := make(map[string]int)
+	var subsets [][]int
+	add := func(set []int) int {
+		key := fmt.Sprint(set)
+		if id, ok := ids[key]; ok {
+			return id
+		}
+		id := len(subsets)
+		ids[key] = id
+		subsets = append(subsets, set)
+		accept := false
+		for _, q := range set {
+			if q == out {
+				accept = true
+			}
+		}
+		m.accept = append(m.accept, accept)
+		return id
+	}
+	add(n.closure([]int{in}))
+	for i := 0; i < len(subsets); i++ {
+		if len(subsets) > dfaMaxStates {
+			return nil, fmt.Errorf("more than %d states", dfaMaxStates)
+		}
+		row := make([]int, len(a.bounds))
+		for c, lo := range a.bounds {
+			var next []int
+			for _, q := range subsets[i] {
+				for _, e := range n.edges[q] {
+					if e.set != nil && e.set.contains(lo) {
+						next = append(next, e.to)
+					}
+				}
+			}
+			if len(next) == 0 {
+				row[c] = -1
+				continue
+			}
+			row[c] = add(n.closure(next))
+		}
+		m.trans = append(m.trans, row)
+	}
+	m.live = make([]bool, len(m.trans))
+	copy(m.live, m.accept)
+	for changed := true; changed; {
+		changed = false
+		for p, row := range m.trans {
+			if m.live[p] {
+				continue
+			}
+			for _, q := range row {
+				if q >= 0 && m.live[q] {
+					m.live[p] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,195 @@
+package peg
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"sort"
+	"testing"
+)
+
+// newDecOctet returns the definition of
+//
+//	decOctet <- "25" [0-5] / "2" [0-4] DIGIT / "1" DIGIT{2} / [1-9] DIGIT / DIGIT
+//
+// with DIGIT, which is [0-9], as digit.
+func newDecOctet(digit Expr) Expr {
+	return NewChoice(
+		NewSequence(NewLiteral("25"), NewCharclass(RuneRange{'0', '5'})),
+		NewSequence(NewLiteral("2"), NewCharclass(RuneRange{'0', '4'}), digit),
+		NewSequence(NewLiteral("1"), NewRepeat(digit, NewLimit(2, 2))),
+		NewSequence(NewCharclass(RuneRange{'1', '9'}), digit),
+		digit,
+	)
+}
+
+func TestCompileDFA(t *testing.T) {
+	decOctet := newDecOctet(NewCharclass(RuneRange{'0', '9'}))
+	digit := NewRule("DIGIT")
+	digit.Define(NewCharclass(RuneRange{'0', '9'}))
+	ipv4 := NewSequence(
+		decOctet, NewLiteral("."), decOctet, NewLiteral("."),
+		decOctet, NewLiteral("."), decOctet,
+	)
+	tests := []struct {
+		name    string
+		g       Expr
+		regular bool
+	}{
+		{"decOctet", decOctet, true},
+		{"IPv4address", ipv4, true},
+		{"rule call", newDecOctet(digit), false},
+		{"tag", NewTag("octet", decOctet), false},
+		{"h16", NewRepeat(NewCharclass(RuneUnion{RuneRange{'0', '9'}, RuneRange{'a', 'f'}}), NewLimit(1, 4)), true},
+		{"digits", NewOneOrMore(NewCharclass(RuneRange{'0', '9'})), true},
+		{"greedy", NewSequence(NewZeroOrMore(NewCharclass(RuneRange{'0', '9'})), NewLiteral("0")), false},
+		{"shadowed", NewChoice(NewLiteral("a"), NewLiteral("ab")), false},
+		{"predicate", NewSequence(NewLiteral("a"), NewNot(NewLiteral("b"))), false},
+		{"recursive", newNestGrammar(), false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := CompileDFA(tc.g)
+			if (err == nil) != tc.regular {
+				t.Errorf("want regular %v; but got %v", tc.regular, err)
+			}
+		})
+	}
+}
+
+// randomRegular generates a small predicate-free expression over "abc".
+func randomRegular(rnd *rand.Rand, depth int) Expr {
+	n := 7
+	if depth == 0 {
+		n = 2
+	}
+	switch rnd.Intn(n) {
+	case 0:
+		return NewLiteral([]string{"a", "b", "c", "ab", "ba", "abc"}[rnd.Intn(6)])
+	case 1:
+		return NewCharclass([]RuneSubset{
+			RuneRange{'a', 'b'},
+			RuneValue('c'),
+			RuneInvert{S: RuneValue('a')},
+		}[rnd.Intn(3)])
+	case 2, 3:
+		exprs := make([]Expr, 1+rnd.Intn(3))
+		for i := range exprs {
+			exprs[i] = randomRegular(rnd, depth-1)
+		}
+		return NewSequence(exprs...)
+	case 4:
+		exprs := make([]Expr, 1+rnd.Intn(3))
+		for i := range exprs {
+			exprs[i] = randomRegular(rnd, depth-1)
+		}
+		return NewChoice(exprs...)
+	case 5:
+		return NewOptional(randomRegular(rnd, depth-1))
+	default:
+		limits := []*Limit{nil, NewLimitLower(1), NewLimit(0, 2), NewLimit(2, 2), NewLimitUpper(3)}
+		return NewRepeat(randomRegular(rnd, depth-1), limits[rnd.Intn(len(limits))])
+	}
+}
+
+func TestDFAProperty(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	compiled := 0
+	for n := 0; n < 2000; n++ {
+		g := randomRegular(rnd, 3)
+		d, err := CompileDFA(g)
+		if err != nil {
+			continue
+		}
+		compiled++
+		for k := 0; k < 50; k++ {
+			b := make([]byte, rnd.Intn(8))
+			for i := range b {
+				b[i] = "abcd"[rnd.Intn(4)]
+			}
+			text := string(b)
+			want := NewScanner(text)
+			_, wok := g.Parse(want)
+			got := NewScanner(text)
+			gt, gok := d.Parse(got)
+			if gok != wok || (wok && got.Pos != want.Pos) || got.LPos != want.LPos {
+				t.Fatalf("%q: want %v %v %v; but got %v %v %v", text, wok, want.Pos, want.LPos, gok, got.Pos, got.LPos)
+			}
+			if gok && (gt.Start != 0 || gt.End != got.Pos) {
+				t.Fatalf("%q: bad tree span %v-%v", text, gt.Start, gt.End)
+			}
+		}
+	}
+	if compiled < 200 {
+		t.Errorf("only %v of 2000 expressions compiled", compiled)
+	}
+}
+
+func TestOptimizeRegular(t *testing.T) {
+	g := OptimizeRegular(newIPv4PrefixGrammar())
+	for _, text := range []string{"192.168.30.254/24", "192.168.30.254", "256.1.1.1/8"} {
+		want := NewScanner(text)
+		_, wok := newIPv4PrefixGrammar().Parse(want)
+		got := NewScanner(text)
+		_, gok := g.Parse(got)
+		if gok != wok || got.LPos != want.LPos {
+			t.Errorf("%q: want %v %v; but got %v %v", text, wok, want.LPos, gok, got.LPos)
+		}
+	}
+}
+
+// taggedSpans lists the tags of t and its descendants with their spans,
+// in depth-first order.
+func taggedSpans(t *Tree) []string {
+	var list []string
+	var visit func(*Tree)
+	visit = func(t *Tree) {
+		if t == nil {
+			return
+		}
+		names := t.TagNames()
+		sort.Strings(names)
+		for _, name := range names {
+			list = append(list, fmt.Sprintf("%v %v-%v", name, t.Start, t.End))
+		}
+		for _, c := range t.Child {
+			visit(c)
+		}
+	}
+	visit(t)
+	return list
+}
+
+func TestOptimizeRegularTrees(t *testing.T) {
+	// ip <- dec "." dec
+	// dec <- [0-9]+
+	ip := NewRule("dfaTreeIP")
+	dec := NewRule("dfaTreeDec")
+	ip.Define(NewSequence(dec, NewLiteral("."), dec))
+	dec.Define(NewOneOrMore(NewCharclass(RuneRange{'0', '9'})))
+	opt := OptimizeRegular(ip)
+	// the tree of dec is one span, but that of ip has the trees of dec
+	for _, r := range rules(opt) {
+		want := r.name == "dfaTreeDec"
+		if _, compiled := r.expr.(*DFA); compiled != want {
+			t.Errorf("%v: want compiled %v; but got %T", r.name, want, r.expr)
+		}
+	}
+	for _, text := range []string{"12.345", "1.2", "1.", "12"} {
+		want, wok := ip.Parse(NewScanner(text))
+		got, gok := opt.Parse(NewScanner(text))
+		if gok != wok {
+			t.Errorf("%q: want %v; but got %v", text, wok, gok)
+			continue
+		}
+		if !wok {
+			continue
+		}
+		if len(got.Child) != len(want.Child) {
+			t.Errorf("%q: want %v children; but got %v", text, len(want.Child), len(got.Child))
+		}
+		if w, g := taggedSpans(want), taggedSpans(got); !slices.Equal(w, g) {
+			t.Errorf("%q: want tags %v; but got %v", text, w, g)
+		}
+	}
+}
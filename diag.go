@@ -0,0 +1,199 @@
+package peg
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Severity tells whether a Diagnostic is an error or a warning.
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// Diagnostic describes a problem in a span of a source text. It renders as
+// a compiler message: the location, the message, the source line and a
+// caret underlining the span.
+type Diagnostic struct {
+	Severity Severity
+	Filename string
+	Text     string
+	// Start and End delimit the span in bytes. An empty span points
+	// between two characters, such as at the end of the input.
+	Start   int
+	End     int
+	Message string
+	// Suggestions are the keywords close to a misspelled word at the
+	// error, which the message also offers.
+	Suggestions []string
+}
+
+// Diagnose explains why expr did not accept the text of scan. The span is
+// the character after the longest match, and the message lists what was
+// expected there, or the error that stopped the parse. If a word there is
+// close to keywords the grammar tried, the message suggests them.
+func Diagnose(expr Expr, scan *Scanner, filename string) *Diagnostic {
+	d := &Diagnostic{
+		Filename: filename,
+		Text:     scan.Text,
+		Start:    scan.LPos,
+		End:      scan.LPos,
+	}
+	if scan.LPos < len(scan.Text) {
+		_, size := utf8.DecodeRuneInString(scan.Text[scan.LPos:])
+		d.End += size
+	}
+	if err := scan.Err(); err != nil {
+		d.Message = err.Error()
+		return d
+	}
+	// what could come next at the end of the longest match is what was
+	// expected there
+	c := Complete(expr, scan.Text[:scan.LPos])
+	d.Message = expectMessage(c.Expected)
+	if d.Message == "" {
+		d.Message = "unexpected " + d.unexpected()
+	} else {
+		d.Message += ", found " + d.unexpected()
+	}
+	d.Suggestions = suggestions(expr, scan.Text, c.Expected, scan.LPos)
+	if len(d.Suggestions) > 0 {
+		d.Message += "; " + didYouMean(d.Suggestions)
+	}
+	return d
+}
+
+// expectMessage names the expected literals and charclasses by their
+// Message.
+func expectMessage(items []Expected) string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, e := range items {
+		// rules and labels are named by the items tried in them
+		if e.Kind == ExpectRule || e.Kind == ExpectLabel {
+			continue
+		}
+		name := e.Message()
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	return "expected " + joinOr(names)
+}
+
+// joinOr joins names as "a, b or c".
+func joinOr(names []string) string {
+	n := len(names) - 1
+	if n == 0 {
+		return names[0]
+	}
+	return strings.Join(names[:n], ", ") + " or " + names[n]
+}
+
+func (d *Diagnostic) unexpected() string {
+	if d.Start >= len(d.Text) {
+		return "end of input"
+	}
+	ch, _ := utf8.DecodeRuneInString(d.Text[d.Start:])
+	return fmt.Sprintf("%q", ch)
+}
+
+// Position returns the line and column of Start, both counted from 1.
+// Columns count runes.
+func (d *Diagnostic) Position() (line, col int) {
+	return lineCol(d.Text, d.Start)
+}
+
+func lineCol(text string, pos int) (line, col int) {
+	before := text[:pos]
+	line = strings.Count(before, "\n") + 1
+	col = utf8.RuneCountInString(before[strings.LastIndexByte(before, '\n')+1:]) + 1
+	return line, col
+}
+
+func (d *Diagnostic) location() string {
+	line, col := d.Position()
+	if d.Filename == "" {
+		return fmt.Sprintf("%v:%v", line, col)
+	}
+	return fmt.Sprintf("%v:%v:%v", d.Filename, line, col)
+}
+
+// Error returns the location and the message on one line. Warnings are
+// marked as such.
+func (d *Diagnostic) Error() string {
+	if d.Severity == SeverityWarning {
+		return d.location() + ": warning: " + d.Message
+	}
+	return d.location() + ": " + d.Message
+}
+
+const (
+	ansiBold    = "\x1b[1m"
+	ansiRed     = "\x1b[1;31m"
+	ansiMagenta = "\x1b[1;35m"
+	ansiBlue    = "\x1b[1;34m"
+	ansiReset   = "\x1b[0m"
+)
+
+// Render writes the diagnostic with its source line, in color if color is
+// set.
+func (d *Diagnostic) Render(w io.Writer, color bool) error {
+	paint := func(code, s string) string {
+		if !color {
+			return s
+		}
+		return code + s + ansiReset
+	}
+	kind := ansiRed
+	if d.Severity == SeverityWarning {
+		kind = ansiMagenta
+	}
+	line, _ := d.Position()
+	bol := strings.LastIndexByte(d.Text[:d.Start], '\n') + 1
+	eol := strings.IndexByte(d.Text[bol:], '\n')
+	if eol < 0 {
+		eol = len(d.Text)
+	} else {
+		eol += bol
+	}
+	// the caret keeps the tabs of the line to stay aligned
+	var pad strings.Builder
+	for _, ch := range d.Text[bol:d.Start] {
+		if ch == '\t' {
+			pad.WriteByte('\t')
+		} else {
+			pad.WriteByte(' ')
+		}
+	}
+	end := min(d.End, eol)
+	width := max(utf8.RuneCountInString(d.Text[d.Start:end]), 1)
+	mark := "^" + strings.Repeat("~", width-1)
+
+	num := fmt.Sprint(line)
+	gutter := strings.Repeat(" ", len(num))
+	_, err := fmt.Fprintf(w, "%s %s %s\n%s %s %s\n%s %s %s%s\n",
+		paint(ansiBold, d.location()+":"), paint(kind, d.Severity.String()+":"), paint(ansiBold, d.Message),
+		paint(ansiBlue, num), paint(ansiBlue, "|"), d.Text[bol:eol],
+		gutter, paint(ansiBlue, "|"), pad.String(), paint(kind, mark))
+	return err
+}
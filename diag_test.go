@@ -0,0 +1,133 @@
+package peg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiagnose(t *testing.T) {
+	g := newIPv4PrefixGrammar()
+	tests := []struct {
+		text string
+		want string
+	}{
+		{
+			text: "192.168.300.1/24",
+			want: `1:11: error: expected ".", found '0'
+1 | 192.168.300.1/24
+  |           ^
+`,
+		},
+		{
+			text: "192.168.30.1/",
+			want: `1:14: error: expected "3", ['1'-'2'] or ['0'-'9'], found end of input
+1 | 192.168.30.1/
+  |              ^
+`,
+		},
+		{
+			text: "192.168.30.1/8x",
+			want: `1:15: error: unexpected 'x'
+1 | 192.168.30.1/8x
+  |               ^
+`,
+		},
+	}
+	for _, tc := range tests {
+		scan := NewScanner(tc.text)
+		if _, ok := g.Parse(scan); ok {
+			t.Fatalf("%q: accepted", tc.text)
+		}
+		var sb strings.Builder
+		Diagnose(g, scan, "").Render(&sb, false)
+		if sb.String() != tc.want {
+			t.Errorf("want\n%s\nbut got\n%s", tc.want, sb.String())
+		}
+	}
+}
+
+func TestDiagnosticRender(t *testing.T) {
+	d := &Diagnostic{
+		Filename: "a.peg",
+		Text:     "a <- b\n\tc <- \"é\" dd\n",
+		Start:    18,
+		End:      20,
+		Message:  "unknown rule",
+	}
+	if got, want := d.Error(), "a.peg:2:11: unknown rule"; got != want {
+		t.Errorf("want %q; but got %q", want, got)
+	}
+	var sb strings.Builder
+	d.Render(&sb, false)
+	want := "a.peg:2:11: error: unknown rule\n2 | \tc <- \"é\" dd\n  | \t         ^~\n"
+	if sb.String() != want {
+		t.Errorf("want %q; but got %q", want, sb.String())
+	}
+	sb.Reset()
+	d.Render(&sb, true)
+	if !strings.Contains(sb.String(), ansiRed+"^~"+ansiReset) {
+		t.Errorf("want a colored caret; but got %q", sb.String())
+	}
+}
+
+func TestDiagnoseLabels(t *testing.T) {
+	prefix := NewRule("labelPrefix")
+	oct := NewRule("labelOct")
+	oct.SetDisplayName("IPv4 octet")
+	digit := NewCharclass(RuneRange{'0', '9'})
+
+	// labelPrefix <- <address: labelOct> "." labelOct "/" <prefix length>
+	prefix.Define(NewSequence(
+		NewExpect(oct, "address"), NewLiteral("."), oct,
+		NewLiteral("/"),
+		NewExpect(NewOneOrMore(digit), "prefix length"),
+		EOT,
+	))
+	// labelOct <- [0-9]+
+	oct.Define(NewOneOrMore(digit))
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		// only the outermost label is named
+		{"", `1:1: expected address, found end of input`},
+		{"1.", `1:3: expected IPv4 octet, found end of input`},
+		{"1.x", `1:3: expected IPv4 octet, found 'x'`},
+		{"1.2/", `1:5: expected prefix length, found end of input`},
+		{"1.2x", `1:4: expected ['0'-'9'] or "/", found 'x'`},
+	}
+	for _, tc := range tests {
+		scan := NewScanner(tc.text)
+		if _, ok := prefix.Parse(scan); ok {
+			t.Fatalf("%q: accepted", tc.text)
+		}
+		got := Diagnose(prefix, scan, "").Error()
+		if got != tc.want {
+			t.Errorf("%q: want %q; but got %q", tc.text, tc.want, got)
+		}
+	}
+}
+func TestDiagnoseLabelStart(t *testing.T) {
+	// a label names a literal only where the literal starts
+	kw := NewExpect(NewLiteral("mask"), "keyword")
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"", `1:1: expected keyword, found end of input`},
+		{"x", `1:1: expected keyword, found 'x'`},
+		{"ma", `1:3: expected "mask", found end of input`},
+		{"mat", `1:3: expected "mask", found 't'`},
+	}
+	for _, tc := range tests {
+		scan := NewScanner(tc.text)
+		if _, ok := kw.Parse(scan); ok {
+			t.Fatalf("%q: accepted", tc.text)
+		}
+		got := Diagnose(kw, scan, "").Error()
+		if got != tc.want {
+			t.Errorf("%q: want %q; but got %q", tc.text, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package peg
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func newArgsGrammar() Expr {
+	// args <- item ("," item)*
+	// item <- call / word
+	// call <- word "(" args? ")"
+	// word <- &[a-z0-9] [a-z0-9]+
+	args := NewRule("args")
+	item := NewRule("item")
+	call := NewRule("call")
+	word := NewRule("word")
+	alnum := NewCharclass(RuneUnion{RuneRange{'a', 'z'}, RuneRange{'0', '9'}})
+	args.Define(NewSequence(item, NewZeroOrMore(NewSequence(NewLiteral(","), item))))
+	item.Define(NewChoice(call, word))
+	call.Define(NewSequence(word, NewLiteral("("), NewOptional(args), NewLiteral(")")))
+	word.Define(NewSequence(NewAnd(alnum), NewOneOrMore(alnum)))
+	return NewSequence(args, EOT)
+}
+
+func TestScannerEdit(t *testing.T) {
+	g := newArgsGrammar()
+	vm, err := Compile(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rnd := rand.New(rand.NewSource(1))
+	random := func(n int) string {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = "ab1,()"[rnd.Intn(6)]
+		}
+		return string(b)
+	}
+	modes := [][]ScannerOption{nil, {WithIncremental()}, {WithIncremental(), WithMapMemo()}}
+	for _, g := range []Expr{g, vm} {
+		for _, opts := range modes {
+			for n := 0; n < 500; n++ {
+				scan := NewScanner(random(rnd.Intn(30)), opts...)
+				g.Parse(scan)
+				for k := 0; k < 5; k++ {
+					offset := rnd.Intn(len(scan.Text) + 1)
+					deleted := rnd.Intn(len(scan.Text) - offset + 1)
+					inserted := random(rnd.Intn(4))
+					scan.Edit(offset, deleted, inserted)
+					gt, gok := g.Parse(scan)
+					want := NewScanner(scan.Text)
+					wt, wok := g.Parse(want)
+					if gok != wok || scan.LPos != want.LPos || (wok && (scan.Pos != want.Pos || !sameTree(gt, wt))) {
+						t.Fatalf("%q (incremental %v): want %v %v %v; but got %v %v %v", scan.Text, len(opts) > 0, wok, want.Pos, want.LPos, gok, scan.Pos, scan.LPos)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestScannerEditShares(t *testing.T) {
+	g := newArgsGrammar()
+	text := strings.Repeat("abc(x,y),", 50) + "z"
+	scan := NewScanner(text, WithIncremental())
+	old, ok := g.Parse(scan)
+	if !ok {
+		t.Fatal("not accepted")
+	}
+	steps := scan.steps
+
+	scan.Edit(len(text)-1, 1, "f(1)")
+	tree, ok := g.Parse(scan)
+	if !ok {
+		t.Fatal("not accepted after edit")
+	}
+	// rules hand out copies of their trees, which share the children
+	if tree.Child[0].Child[0].Child[0] != old.Child[0].Child[0].Child[0] {
+		t.Errorf("the first item is not shared")
+	}
+	if scan.steps*4 > steps {
+		t.Errorf("want far fewer than %v steps; but got %v", steps, scan.steps)
+	}
+
+	// an edit at the start moves every later entry
+	scan.Edit(0, 0, "q,")
+	tree, ok = g.Parse(scan)
+	want, _ := g.Parse(NewScanner(scan.Text))
+	if !ok || !sameTree(tree, want) {
+		t.Errorf("want the tree of %q", scan.Text)
+	}
+}
+
+func TestScannerEditPlain(t *testing.T) {
+	g := newArgsGrammar()
+	text := strings.Repeat("abc(x,y),", 10) + "z"
+	scan := NewScanner(text)
+	if _, ok := g.Parse(scan); !ok {
+		t.Fatal("not accepted")
+	}
+	scan.Edit(len(text)-1, 1, "f(1)")
+	scan.EachMemo(func(pos int, name string, memo Memo) {
+		if memo.Tree != nil {
+			t.Errorf("%v at %v: want no tree", name, pos)
+		}
+	})
+
+	tree, ok := g.Parse(scan)
+	want, _ := g.Parse(NewScanner(scan.Text))
+	if !ok || !sameTree(tree, want) {
+		t.Errorf("want the tree of %q", scan.Text)
+	}
+
+	// the entries stored by Match have no trees and are kept for Match
+	scan, ok = Match(g, text)
+	if !ok {
+		t.Fatal("not matched")
+	}
+	steps := scan.steps
+	scan.Edit(len(text)-1, 1, "f(1)")
+	if !scan.match(g) {
+		t.Fatal("not matched after edit")
+	}
+	if scan.steps*4 > steps {
+		t.Errorf("want far fewer than %v steps; but got %v", steps, scan.steps)
+	}
+}
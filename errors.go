@@ -0,0 +1,63 @@
+package peg
+
+import (
+	"fmt"
+)
+
+// CanceledError is reported by Scanner.Err when the scanner context is
+// done before the parse finishes.
+type CanceledError struct {
+	Pos int
+	Err error
+}
+
+func (e *CanceledError) Error() string {
+	return fmt.Sprintf("parse canceled at %v: %v", e.Pos, e.Err)
+}
+
+func (e *CanceledError) Unwrap() error {
+	return e.Err
+}
+
+// StepLimitError is reported by Scanner.Err when the parse evaluates more
+// expressions than allowed by WithMaxSteps.
+type StepLimitError struct {
+	Pos   int
+	Limit int
+}
+
+func (e *StepLimitError) Error() string {
+	return fmt.Sprintf("step limit %v exceeded at %v", e.Limit, e.Pos)
+}
+
+// DepthLimitError is reported by Scanner.Err when rules nest deeper than
+// allowed by WithMaxDepth.
+type DepthLimitError struct {
+	Pos   int
+	Limit int
+}
+
+func (e *DepthLimitError) Error() string {
+	return fmt.Sprintf("depth limit %v exceeded at %v", e.Limit, e.Pos)
+}
+
+// MemoLimitError is reported by Scanner.Err when the memo table grows
+// beyond the size allowed by WithMaxMemo.
+type MemoLimitError struct {
+	Pos   int
+	Limit int
+}
+
+func (e *MemoLimitError) Error() string {
+	return fmt.Sprintf("memo limit %v exceeded at %v", e.Limit, e.Pos)
+}
+
+// SyntaxError is returned by Parser when the grammar does not accept the
+// text. Pos is the end of the longest match.
+type SyntaxError struct {
+	Pos int
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at %v", e.Pos)
+}
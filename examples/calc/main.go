@@ -16,8 +16,7 @@ func main() {
 	g := NewCalcGrammar()
 	t, ok := g.Parse(scan)
 	if !ok {
-		fmt.Println("Error: not accepted.")
-		fmt.Printf("longest match: %q\n", scan.Longest())
+		peg.Diagnose(g, scan, "").Render(os.Stdout, false)
 		os.Exit(1)
 	}
 	calc := NewCalc(scan.Text)
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/khirono/go-peg"
+)
+
+var benchAddrs = []string{
+	"2001:0db8:85a3:0000:0000:8a2e:0370:7334",
+	"2001:db8:85a3:0:0:8a2e:370:7334",
+	"::ffff:192.0.2.128",
+}
+
+func BenchmarkMemo(b *testing.B) {
+	backends := []struct {
+		name string
+		opts []peg.ScannerOption
+	}{
+		{"map", []peg.ScannerOption{peg.WithMapMemo()}},
+		{"dense", nil},
+	}
+	g := peg.NewSequence(NewGrammar(), peg.EOT)
+	for _, backend := range backends {
+		b.Run("parse/"+backend.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for _, addr := range benchAddrs {
+					scan := peg.NewScanner(addr, backend.opts...)
+					if _, ok := g.Parse(scan); !ok {
+						b.Fatalf("not accepted: %q", addr)
+					}
+				}
+			}
+		})
+		b.Run("match/"+backend.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for _, addr := range benchAddrs {
+					if _, ok := peg.Match(g, addr, backend.opts...); !ok {
+						b.Fatalf("not accepted: %q", addr)
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkArena(b *testing.B) {
+	g := peg.NewSequence(NewGrammar(), peg.EOT)
+	b.ReportAllocs()
+	arena := peg.NewArena()
+	for i := 0; i < b.N; i++ {
+		for _, addr := range benchAddrs {
+			arena.Reset()
+			scan := peg.NewScanner(addr, peg.WithArena(arena))
+			if _, ok := g.Parse(scan); !ok {
+				b.Fatalf("not accepted: %q", addr)
+			}
+		}
+	}
+}
+
+func BenchmarkMatch(b *testing.B) {
+	g := peg.NewSequence(NewGrammar(), peg.EOT)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, addr := range benchAddrs {
+			if _, ok := peg.Match(g, addr); !ok {
+				b.Fatalf("not accepted: %q", addr)
+			}
+		}
+	}
+}
+
+func BenchmarkVM(b *testing.B) {
+	g := peg.NewSequence(NewGrammar(), peg.EOT)
+	vm, err := peg.Compile(g)
+	if err != nil {
+		b.Fatal(err)
+	}
+	engines := []struct {
+		name string
+		g    peg.Expr
+	}{
+		{"interpreter", g},
+		{"vm", vm},
+	}
+	for _, engine := range engines {
+		b.Run("parse/"+engine.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for _, addr := range benchAddrs {
+					scan := peg.NewScanner(addr)
+					if _, ok := engine.g.Parse(scan); !ok {
+						b.Fatalf("not accepted: %q", addr)
+					}
+				}
+			}
+		})
+		b.Run("match/"+engine.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for _, addr := range benchAddrs {
+					if _, ok := peg.Match(engine.g, addr); !ok {
+						b.Fatalf("not accepted: %q", addr)
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkOptimize(b *testing.B) {
+	grammars := []struct {
+		name string
+		g    peg.Expr
+	}{
+		{"source", peg.NewSequence(NewGrammar(), peg.EOT)},
+		{"optimized", peg.NewSequence(peg.Optimize(NewGrammar()), peg.EOT)},
+	}
+	for _, grammar := range grammars {
+		b.Run(grammar.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for _, addr := range benchAddrs {
+					if _, ok := peg.Match(grammar.g, addr); !ok {
+						b.Fatalf("not accepted: %q", addr)
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkParser(b *testing.B) {
+	g := peg.NewSequence(NewGrammar(), peg.EOT)
+	b.Run("scanner", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				for _, addr := range benchAddrs {
+					if _, ok := g.Parse(peg.NewScanner(addr)); !ok {
+						b.Fatalf("not accepted: %q", addr)
+					}
+				}
+			}
+		})
+	})
+	b.Run("parser", func(b *testing.B) {
+		p := peg.NewParser(g)
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				for _, addr := range benchAddrs {
+					if _, err := p.Parse(addr); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	})
+}
@@ -15,6 +15,13 @@ func NewGrammar() peg.Expr {
 	DIGIT := peg.NewRule("DIGIT")
 	HEXDIG := peg.NewRule("HEXDIG")
 
+	h16.SetDisplayName("hex group")
+	decOctet.SetDisplayName("decimal octet")
+	DIGIT.NoMemo()
+	HEXDIG.NoMemo()
+
+	// IPv6address is an IPv6 address in the text form of RFC 4291,
+	// section 2.2.
 	IPv6address.Define(
 		peg.NewChoice(
 			peg.NewSequence(
@@ -205,6 +212,7 @@ func NewGrammar() peg.Expr {
 			),
 		),
 	)
+	// h16 is 16 bits of address represented in hexadecimal.
 	h16.Define(
 		peg.NewSequence(
 			peg.NewRepeat(
@@ -218,6 +226,8 @@ func NewGrammar() peg.Expr {
 			),
 		),
 	)
+	// ls32 is the least-significant 32 bits of address, two h16 or an IPv4
+	// address.
 	ls32.Define(
 		peg.NewChoice(
 			peg.NewSequence(
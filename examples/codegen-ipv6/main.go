@@ -4,6 +4,7 @@ package main
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/khirono/go-peg"
 )
@@ -23,6 +24,7 @@ func Do(g peg.Expr, text string) {
 	fmt.Printf("accepted: %v\n", accepted)
 	fmt.Printf("pos: %v\n", scan.Pos)
 	fmt.Printf("lpos: %v\n", scan.LPos)
-	matched := scan.Longest()
-	fmt.Printf("longest matched: %q\n", matched)
+	if !accepted {
+		peg.Diagnose(g, scan, "").Render(os.Stdout, false)
+	}
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/khirono/go-peg"
 )
@@ -16,13 +17,13 @@ func main() {
 }
 
 func Do(g peg.Expr, text string) {
-	scan := peg.NewScanner(text)
-	_, accepted := g.Parse(scan)
+	scan, accepted := peg.Match(g, text)
 	fmt.Printf("accepted: %v\n", accepted)
 	fmt.Printf("pos: %v\n", scan.Pos)
 	fmt.Printf("lpos: %v\n", scan.LPos)
-	matched := scan.Longest()
-	fmt.Printf("longest matched: %q\n", matched)
+	if !accepted {
+		peg.Diagnose(g, scan, "").Render(os.Stdout, false)
+	}
 }
 
 func NewIPv6PrefixGrammar() peg.Expr {
@@ -203,18 +204,18 @@ func NewIPv6PrefixGrammar() peg.Expr {
 		peg.NewSequence(
 			peg.NewRepeat(peg.NewSequence(
 				peg.NewOneOrMore(peg.NewCharclass(
-					peg.RuneInvert{peg.RuneValue(':')},
+					peg.RuneInvert{S: peg.RuneValue(':')},
 				)),
 				peg.NewLiteral(":"),
 			), peg.NewLimit(6, 6)),
 			peg.NewChoice(
 				peg.NewSequence(
 					peg.NewOneOrMore(peg.NewCharclass(
-						peg.RuneInvert{peg.RuneValue(':')},
+						peg.RuneInvert{S: peg.RuneValue(':')},
 					)),
 					peg.NewLiteral(":"),
 					peg.NewOneOrMore(peg.NewCharclass(
-						peg.RuneInvert{peg.RuneValue(':')},
+						peg.RuneInvert{S: peg.RuneValue(':')},
 					)),
 				),
 				peg.NewSequence(
@@ -228,24 +229,24 @@ func NewIPv6PrefixGrammar() peg.Expr {
 			peg.NewOptional(peg.NewSequence(
 				peg.NewZeroOrMore(peg.NewSequence(
 					peg.NewOneOrMore(peg.NewCharclass(
-						peg.RuneInvert{peg.RuneValue(':')},
+						peg.RuneInvert{S: peg.RuneValue(':')},
 					)),
 					peg.NewLiteral(":"),
 				)),
 				peg.NewOneOrMore(peg.NewCharclass(
-					peg.RuneInvert{peg.RuneValue(':')},
+					peg.RuneInvert{S: peg.RuneValue(':')},
 				)),
 			)),
 			peg.NewLiteral("::"),
 			peg.NewOptional(peg.NewSequence(
 				peg.NewZeroOrMore(peg.NewSequence(
 					peg.NewOneOrMore(peg.NewCharclass(
-						peg.RuneInvert{peg.RuneValue(':')},
+						peg.RuneInvert{S: peg.RuneValue(':')},
 					)),
 					peg.NewLiteral(":"),
 				)),
 				peg.NewOneOrMore(peg.NewCharclass(
-					peg.RuneInvert{peg.RuneValue(':')},
+					peg.RuneInvert{S: peg.RuneValue(':')},
 				)),
 			)),
 			peg.NewLiteral("/"),
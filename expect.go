@@ -0,0 +1,39 @@
+package peg
+
+var _ Expr = &Expect{}
+
+// Expect labels an expression for error messages and completion. When the
+// expression fails where it starts, its message is reported as expected
+// instead of the literals and charclasses inside it. It does not change
+// what is parsed or the tree.
+type Expect struct {
+	expr Expr
+	msg  string
+}
+
+func NewExpect(expr Expr, msg string) *Expect {
+	e := new(Expect)
+	e.expr = expr
+	e.msg = msg
+	return e
+}
+
+func (e *Expect) Parse(scan *Scanner) (*Tree, bool) {
+	if scan.expect == nil {
+		return scan.parse(e.expr)
+	}
+	scan.expect.push(nil, e.msg, scan.Pos)
+	t, ok := scan.parse(e.expr)
+	scan.expect.pop()
+	return t, ok
+}
+
+func (e *Expect) Match(scan *Scanner) bool {
+	if scan.expect == nil {
+		return scan.match(e.expr)
+	}
+	scan.expect.push(nil, e.msg, scan.Pos)
+	ok := scan.match(e.expr)
+	scan.expect.pop()
+	return ok
+}
@@ -1,5 +1,13 @@
 package peg
 
+// Expr is a parsing expression. Parse matches the expression at s.Pos and
+// reports whether it succeeded, leaving s.Pos after the match.
+//
+// Expressions keep no state of their own while parsing: everything a parse
+// changes lives in the Scanner. A grammar can therefore be shared by any
+// number of goroutines as long as each uses its own Scanner and no rule is
+// redefined meanwhile. Implementations outside this package must follow
+// the same rule to be used by a Parser.
 type Expr interface {
 	Parse(s *Scanner) (*Tree, bool)
 }
@@ -0,0 +1,187 @@
+package peg
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// WriteGo writes Go statements that build the grammar reachable from expr
+// with the constructors of this package and return it, as the body of a
+// function returning Expr. ident gives the name of the variable of each
+// rule. The generated code imports this package as peg. It is used by
+// cmd/gen to generate the code of optimized grammars.
+func WriteGo(w io.Writer, expr Expr, ident func(name string) string) error {
+	g := &goWriter{ident: ident}
+	list := rules(expr)
+	for _, r := range list {
+		fmt.Fprintf(&g.buf, "%s := peg.NewRule(%q)\n", ident(r.name), r.name)
+	}
+	fmt.Fprintln(&g.buf)
+	set := false
+	for _, r := range list {
+		switch r.policy {
+		case memoOn:
+			fmt.Fprintf(&g.buf, "%s.Memo()\n", ident(r.name))
+			set = true
+		case memoOff:
+			fmt.Fprintf(&g.buf, "%s.NoMemo()\n", ident(r.name))
+			set = true
+		}
+		if r.display != "" {
+			fmt.Fprintf(&g.buf, "%s.SetDisplayName(%q)\n", ident(r.name), r.display)
+			set = true
+		}
+		if r.hidden {
+			fmt.Fprintf(&g.buf, "%s.Hide()\n", ident(r.name))
+			set = true
+		}
+	}
+	if set {
+		fmt.Fprintln(&g.buf)
+	}
+	for _, r := range list {
+		if r.expr == nil {
+			continue
+		}
+		fmt.Fprintf(&g.buf, "%s.Define(\n", ident(r.name))
+		if err := g.expr(r.expr); err != nil {
+			return err
+		}
+		fmt.Fprintln(&g.buf, ")")
+	}
+	fmt.Fprint(&g.buf, "return ")
+	if err := g.expr(expr); err != nil {
+		return err
+	}
+	// the expression is written as an argument
+	g.buf.Truncate(g.buf.Len() - len(",\n"))
+	fmt.Fprintln(&g.buf)
+	_, err := w.Write(g.buf.Bytes())
+	return err
+}
+
+type goWriter struct {
+	buf   bytes.Buffer
+	ident func(name string) string
+}
+
+// expr writes e as an argument, followed by a comma.
+func (g *goWriter) expr(e Expr) error {
+	switch e {
+	case Any:
+		fmt.Fprintln(&g.buf, "peg.Any,")
+		return nil
+	case EOT:
+		fmt.Fprintln(&g.buf, "peg.EOT,")
+		return nil
+	}
+	switch e := e.(type) {
+	case *Rule:
+		fmt.Fprintf(&g.buf, "%s,\n", g.ident(e.name))
+		return nil
+	case *Sequence:
+		return g.call("peg.NewSequence(", e.exprs...)
+	case *Choice:
+		return g.call("peg.NewChoice(", e.exprs...)
+	case *Repeat:
+		l := e.limit
+		switch {
+		case !l.lowervalid && !l.uppervalid:
+			return g.call("peg.NewZeroOrMore(", e.expr)
+		case l.lowervalid && !l.uppervalid && l.lower == 1:
+			return g.call("peg.NewOneOrMore(", e.expr)
+		}
+		fmt.Fprintln(&g.buf, "peg.NewRepeat(")
+		if err := g.expr(e.expr); err != nil {
+			return err
+		}
+		switch {
+		case l.lowervalid && l.uppervalid:
+			fmt.Fprintf(&g.buf, "peg.NewLimit(%v, %v),\n", l.lower, l.upper)
+		case l.lowervalid:
+			fmt.Fprintf(&g.buf, "peg.NewLimitLower(%v),\n", l.lower)
+		default:
+			fmt.Fprintf(&g.buf, "peg.NewLimitUpper(%v),\n", l.upper)
+		}
+		fmt.Fprintln(&g.buf, "),")
+		return nil
+	case *Optional:
+		return g.call("peg.NewOptional(", e.expr)
+	case *And:
+		return g.call("peg.NewAnd(", e.expr)
+	case *Not:
+		return g.call("peg.NewNot(", e.expr)
+	case *Tag:
+		return g.call(fmt.Sprintf("peg.NewTag(%q,", e.name), e.expr)
+	case *Expect:
+		fmt.Fprintln(&g.buf, "peg.NewExpect(")
+		if err := g.expr(e.expr); err != nil {
+			return err
+		}
+		fmt.Fprintf(&g.buf, "%q,\n", e.msg)
+		fmt.Fprintln(&g.buf, "),")
+		return nil
+	case *Literal:
+		fmt.Fprintf(&g.buf, "peg.NewLiteral(%q),\n", e.text)
+		return nil
+	case *literalSet:
+		fmt.Fprintln(&g.buf, "peg.NewLiteralSet(")
+		for _, text := range e.texts {
+			fmt.Fprintf(&g.buf, "%q,\n", text)
+		}
+		fmt.Fprintln(&g.buf, "),")
+		return nil
+	case *Charclass:
+		fmt.Fprintln(&g.buf, "peg.NewCharclass(")
+		if err := g.set(e.set); err != nil {
+			return err
+		}
+		fmt.Fprintln(&g.buf, "),")
+		return nil
+	default:
+		return fmt.Errorf("cannot write %T as Go code", e)
+	}
+}
+
+// call writes a call of a constructor that takes exprs. start is written
+// before the arguments and ends with the opening parenthesis.
+func (g *goWriter) call(start string, exprs ...Expr) error {
+	fmt.Fprintln(&g.buf, start)
+	for _, c := range exprs {
+		if err := g.expr(c); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(&g.buf, "),")
+	return nil
+}
+
+// set writes set as an argument, followed by a comma.
+func (g *goWriter) set(set RuneSubset) error {
+	switch set := set.(type) {
+	case RuneAny:
+		fmt.Fprintln(&g.buf, "peg.RuneAny{},")
+	case RuneValue:
+		fmt.Fprintf(&g.buf, "peg.RuneValue(%#v),\n", rune(set))
+	case RuneRange:
+		fmt.Fprintf(&g.buf, "peg.RuneRange{%#v, %#v},\n", set[0], set[1])
+	case RuneInvert:
+		fmt.Fprint(&g.buf, "peg.RuneInvert{\nS: ")
+		if err := g.set(set.S); err != nil {
+			return err
+		}
+		fmt.Fprintln(&g.buf, "},")
+	case RuneUnion:
+		fmt.Fprintln(&g.buf, "peg.RuneUnion{")
+		for _, s := range set {
+			if err := g.set(s); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintln(&g.buf, "},")
+	default:
+		return fmt.Errorf("cannot write %T as Go code", set)
+	}
+	return nil
+}
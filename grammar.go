@@ -0,0 +1,253 @@
+package peg
+
+import (
+	"fmt"
+
+	"github.com/khirono/go-peg/ast"
+)
+
+var _ Expr = &Grammar{}
+
+// Grammar is a grammar built at run time from the .peg language. It
+// parses from its first rule.
+type Grammar struct {
+	rules []*Rule
+	names map[string]*Rule
+	docs  map[string]string
+	prog  *ast.Program
+}
+
+// LoadGrammar builds the grammar of a .peg source. Syntax errors are
+// reported as a *Diagnostic.
+func LoadGrammar(src string) (*Grammar, error) {
+	prog, err := ParseGrammar("", src)
+	if err != nil {
+		return nil, err
+	}
+	return BuildGrammar(prog)
+}
+
+// ParseGrammar parses a .peg source into its syntax tree. Syntax errors are
+// reported as a *Diagnostic for filename.
+func ParseGrammar(filename, src string) (*ast.Program, error) {
+	scan := NewScanner(src)
+	g := NewPEGGrammar()
+	t, ok := g.Parse(scan)
+	if !ok {
+		return nil, Diagnose(g, scan, filename)
+	}
+	b := NewASTBuilder(filename, scan.Text)
+	return b.Build(t)
+}
+
+// BuildGrammar makes the rules of prog, as the generated code of prog
+// would. It fails with the first error found by Check, as a grammar with
+// left recursion would never return from a parse. Errors are reported as a
+// *Diagnostic if prog has its source text.
+func BuildGrammar(prog *ast.Program) (*Grammar, error) {
+	for _, d := range Check(prog) {
+		if d.Severity != SeverityError {
+			continue
+		}
+		if prog.Text == "" {
+			return nil, fmt.Errorf("%s", d.Message)
+		}
+		return nil, d
+	}
+	g := new(Grammar)
+	g.prog = prog
+	g.names = make(map[string]*Rule)
+	g.docs = make(map[string]string)
+	for _, stmt := range prog.Stmts {
+		r := NewRule(stmt.Ident.Name)
+		for _, a := range stmt.Annotations {
+			switch a.Name {
+			case "memo":
+				r.Memo()
+			case "nomemo":
+				r.NoMemo()
+			}
+		}
+		if stmt.Label != "" {
+			r.SetDisplayName(stmt.Label)
+		}
+		g.rules = append(g.rules, r)
+		g.names[stmt.Ident.Name] = r
+		if stmt.Doc != "" {
+			g.docs[stmt.Ident.Name] = stmt.Doc
+		}
+	}
+	for i, stmt := range prog.Stmts {
+		expr, err := g.build(stmt.Expr)
+		if err != nil {
+			return nil, err
+		}
+		g.rules[i].Define(expr)
+	}
+	numberRules(g.rules)
+	return g, nil
+}
+
+// Start returns the first rule.
+func (g *Grammar) Start() *Rule {
+	return g.rules[0]
+}
+
+// Rule returns the rule named name, or nil.
+func (g *Grammar) Rule(name string) *Rule {
+	return g.names[name]
+}
+
+// Doc returns the comments written right above the rule named name.
+func (g *Grammar) Doc(name string) string {
+	return g.docs[name]
+}
+
+// Rules returns the rules in the order of the source.
+func (g *Grammar) Rules() []*Rule {
+	return g.rules
+}
+
+func (g *Grammar) Parse(scan *Scanner) (*Tree, bool) {
+	return g.rules[0].Parse(scan)
+}
+
+func (g *Grammar) Match(scan *Scanner) bool {
+	return g.rules[0].Match(scan)
+}
+
+func (g *Grammar) build(expr ast.Expr) (Expr, error) {
+	switch expr := expr.(type) {
+	case *ast.ChoiceExpr:
+		exprs, err := g.buildAll(expr.Exprs)
+		if err != nil {
+			return nil, err
+		}
+		return NewChoice(exprs...), nil
+	case *ast.SequenceExpr:
+		exprs, err := g.buildAll(expr.Exprs)
+		if err != nil {
+			return nil, err
+		}
+		return NewSequence(exprs...), nil
+	case *ast.ZeroOrMoreExpr:
+		e, err := g.build(expr.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return NewZeroOrMore(e), nil
+	case *ast.OneOrMoreExpr:
+		e, err := g.build(expr.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return NewOneOrMore(e), nil
+	case *ast.RepeatExpr:
+		e, err := g.build(expr.Expr)
+		if err != nil {
+			return nil, err
+		}
+		limit, err := buildLimit(&expr.Limit)
+		if err != nil {
+			return nil, err
+		}
+		return NewRepeat(e, limit), nil
+	case *ast.OptionalExpr:
+		e, err := g.build(expr.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return NewOptional(e), nil
+	case *ast.TagExpr:
+		e, err := g.build(expr.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return NewTag(expr.Name, e), nil
+	case *ast.AndExpr:
+		e, err := g.build(expr.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return NewAnd(e), nil
+	case *ast.NotExpr:
+		e, err := g.build(expr.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return NewNot(e), nil
+	case *ast.Charclass:
+		var set RuneSubset = buildCharRange(expr.Set)
+		if expr.Invert {
+			set = RuneInvert{set}
+		}
+		return NewCharclass(set), nil
+	case *ast.Literal:
+		return NewLiteral(expr.Text), nil
+	case *ast.Ident:
+		r, ok := g.names[expr.Name]
+		if !ok {
+			return nil, sourceError(g.prog, expr, "undefined rule %v", expr.Name)
+		}
+		return r, nil
+	case *ast.Any:
+		return Any, nil
+	case *ast.EOT:
+		return EOT, nil
+	default:
+		return nil, fmt.Errorf("unknown type: %T", expr)
+	}
+}
+
+// sourceError reports a problem with node n of prog as a *Diagnostic, or as
+// a plain error if prog was not parsed from a source text.
+func sourceError(prog *ast.Program, n ast.Node, format string, args ...any) error {
+	if prog.Text == "" {
+		return fmt.Errorf(format, args...)
+	}
+	span := n.Range()
+	return &Diagnostic{
+		Filename: prog.Filename,
+		Text:     prog.Text,
+		Start:    span.Start,
+		End:      span.End,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+func (g *Grammar) buildAll(exprs []ast.Expr) ([]Expr, error) {
+	list := make([]Expr, len(exprs))
+	for i, expr := range exprs {
+		e, err := g.build(expr)
+		if err != nil {
+			return nil, err
+		}
+		list[i] = e
+	}
+	return list, nil
+}
+
+func buildCharRange(set []ast.CharRange) RuneUnion {
+	u := make(RuneUnion, len(set))
+	for i, r := range set {
+		if r.Lower == r.Upper {
+			u[i] = RuneValue(r.Lower)
+		} else {
+			u[i] = RuneRange{r.Lower, r.Upper}
+		}
+	}
+	return u
+}
+
+func buildLimit(l *ast.Limit) (*Limit, error) {
+	switch {
+	case l.LowerValid && l.UpperValid:
+		return NewLimit(l.Lower, l.Upper), nil
+	case l.LowerValid:
+		return NewLimitLower(l.Lower), nil
+	case l.UpperValid:
+		return NewLimitUpper(l.Upper), nil
+	default:
+		return nil, fmt.Errorf("not found limit valid")
+	}
+}
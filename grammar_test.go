@@ -0,0 +1,288 @@
+package peg
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/khirono/go-peg/ast"
+)
+
+func TestLoadGrammar(t *testing.T) {
+	g, err := LoadGrammar(`
+loadPrefix <- loadAddr "/" loadMask EOT
+
+loadAddr <- (loadOct "."){3} loadOct
+
+loadOct "IPv4 octet" <-
+	"25" [0-5] /
+	"2" [0-4] [0-9] /
+	"1" [0-9]{2} /
+	[1-9] [0-9] /
+	[0-9]
+
+@nomemo
+loadMask <- "3" [0-2] / [1-2] [0-9] / [0-9]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Start() != g.Rule("loadPrefix") || len(g.Rules()) != 4 {
+		t.Errorf("unexpected rules %v", g.Rules())
+	}
+	tests := []struct {
+		text string
+		ok   bool
+	}{
+		{"192.168.0.1/24", true},
+		{"255.255.255.255/32", true},
+		{"192.168.0.1/33", false},
+		{"256.0.0.1/8", false},
+		{"192.168.0/8", false},
+	}
+	for _, tc := range tests {
+		scan := NewScanner(tc.text)
+		if _, ok := g.Parse(scan); ok != tc.ok {
+			t.Errorf("%q: want %v; but got %v", tc.text, tc.ok, ok)
+		}
+		if _, ok := Match(g, tc.text); ok != tc.ok {
+			t.Errorf("%q: Match: want %v; but got %v", tc.text, tc.ok, ok)
+		}
+	}
+
+	scan := NewScanner("192.168.0./8")
+	g.Parse(scan)
+	want := "1:11: expected IPv4 octet, found '/'"
+	if got := Diagnose(g, scan, "").Error(); got != want {
+		t.Errorf("want %q; but got %q", want, got)
+	}
+}
+
+func TestLoadGrammarErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"a <- b", "1:6: undefined rule b"},
+		{"a <- \"x\"\na <- \"y\"", "2:1: rule a redefined, first defined on line 1"},
+		{"@fast\na <- \"x\"", "1:2: unknown annotation @fast"},
+		{"", "no rules"},
+		{"a <- a \"x\" / \"y\"", "1:6: left recursion: a -> a"},
+		{"a <- b \"x\"\nb <- \"y\"? a", "1:6: left recursion: a -> b -> a"},
+		{"a <- \"x\"{3,2}", "1:9: invalid limit: lower bound 3 is greater than upper bound 2"},
+	}
+	for _, tc := range tests {
+		_, err := LoadGrammar(tc.src)
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("%q: want error %q; but got %v", tc.src, tc.want, err)
+		}
+	}
+
+	_, err := LoadGrammar("a <- \"x\" /\n")
+	var d *Diagnostic
+	if !errors.As(err, &d) {
+		t.Fatalf("want a *Diagnostic; but got %v", err)
+	}
+	if line, _ := d.Position(); line != 2 {
+		t.Errorf("want an error on line 2; but got %v", d)
+	}
+}
+
+func TestLoadGrammarSkippedOptional(t *testing.T) {
+	g, err := LoadGrammar("a <- \"x\"? / \"y\"\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm, err := Compile(g.Start())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first alternative matches nothing on "z"
+	for _, e := range []Expr{g, Optimize(g), OptimizeRegular(g), vm} {
+		for _, text := range []string{"z", "x", ""} {
+			tree, ok := e.Parse(NewScanner(text))
+			if !ok || tree == nil || tree.Index != 0 {
+				t.Errorf("%T %q: want the first alternative; but got %v %v", e, text, ok, tree)
+			}
+		}
+	}
+}
+
+func TestLoadGrammarFile(t *testing.T) {
+	src, err := os.ReadFile("examples/codegen-ipv6/ipv6addr.peg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := LoadGrammar(string(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewSequence(g, EOT)
+	for _, text := range []string{
+		"2001:0db8:85a3:0000:0000:8a2e:0370:7334",
+		"::ffff:192.0.2.128",
+		"::1",
+	} {
+		if _, ok := e.Parse(NewScanner(text)); !ok {
+			t.Errorf("%q: not accepted", text)
+		}
+	}
+}
+
+func TestGrammarComments(t *testing.T) {
+	g, err := LoadGrammar(`# A list of words.
+# See the tests.
+
+// commentList is a list of words
+//
+// separated by commas.
+commentList <- commentWord ("," commentWord)* # not a doc comment
+	/* comments go anywhere */ EOT
+
+/*
+ * commentWord is a word.
+ */
+@nomemo
+commentWord <- [a-z]+ // [a-z]* would accept empty words
+
+// this is not commentSpace's doc
+
+commentSpace <- " "*
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := map[string]string{
+		"commentList":  "commentList is a list of words\n\nseparated by commas.",
+		"commentWord":  "commentWord is a word.",
+		"commentSpace": "",
+	}
+	for name, want := range docs {
+		if got := g.Doc(name); got != want {
+			t.Errorf("%v: want doc %q; but got %q", name, want, got)
+		}
+	}
+	if _, ok := Match(g, "ab,c"); !ok {
+		t.Errorf("not accepted")
+	}
+
+	_, err = LoadGrammar("a <- \"x\" /* open")
+	var d *Diagnostic
+	if !errors.As(err, &d) {
+		t.Errorf("want a *Diagnostic; but got %v", err)
+	}
+}
+
+func TestParseGrammarSpans(t *testing.T) {
+	src := "@nomemo\nspanA <- \"x\" spanB* # words\n\t/ ( [0-9]{2} . )\nspanB <- (!EOT 'y'?)\n"
+	prog, err := ParseGrammar("spans.peg", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := func(n ast.Node) string {
+		s := n.Range()
+		return src[s.Start:s.End]
+	}
+	a, b := prog.Stmts[0], prog.Stmts[1]
+	choice := a.Expr.(*ast.ChoiceExpr)
+	seq := choice.Exprs[0].(*ast.SequenceExpr)
+	group := choice.Exprs[1].(*ast.SequenceExpr)
+	repeat := group.Exprs[0].(*ast.RepeatExpr)
+	bseq := b.Expr.(*ast.SequenceExpr)
+	tests := []struct {
+		node ast.Node
+		want string
+	}{
+		{a, "@nomemo\nspanA <- \"x\" spanB* # words\n\t/ ( [0-9]{2} . )"},
+		{a.Annotations[0], "@nomemo"},
+		{a.Ident, "spanA"},
+		{choice, "\"x\" spanB* # words\n\t/ ( [0-9]{2} . )"},
+		{seq, "\"x\" spanB*"},
+		{seq.Exprs[0], "\"x\""},
+		{seq.Exprs[1], "spanB*"},
+		{seq.Exprs[1].(*ast.ZeroOrMoreExpr).Expr, "spanB"},
+		{group, "[0-9]{2} ."},
+		{repeat, "[0-9]{2}"},
+		{repeat.Limit, "{2}"},
+		{repeat.Expr.(*ast.Charclass).Set[0], "0-9"},
+		{group.Exprs[1], "."},
+		{b, "spanB <- (!EOT 'y'?)"},
+		{bseq, "!EOT 'y'?"},
+		{bseq.Exprs[0].(*ast.NotExpr).Expr, "EOT"},
+		{bseq.Exprs[1], "'y'?"},
+	}
+	for i, tc := range tests {
+		if got := text(tc.node); got != tc.want {
+			t.Errorf("%v: want %q; but got %q", i, tc.want, got)
+		}
+	}
+
+	prog.Stmts[1].Expr = &ast.Ident{Span: ast.Span{Start: 10, End: 15}, Name: "spanC"}
+	_, err = BuildGrammar(prog)
+	var d *Diagnostic
+	if !errors.As(err, &d) {
+		t.Fatalf("want a *Diagnostic; but got %v", err)
+	}
+	if got, want := fmt.Sprint(d), "spans.peg:2:3: undefined rule spanC; did you mean \"spanA\" or \"spanB\"?"; got != want {
+		t.Errorf("want %q; but got %q", want, got)
+	}
+}
+
+func TestGrammarTags(t *testing.T) {
+	g, err := LoadGrammar(`
+tagPair <- key:tagWord "=" @value(tagWord / tagNum) note:(";" tagWord)? EOT
+tagWord <- [a-z]+
+tagNum <- [0-9]+
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := "abc=42"
+	scan := NewScanner(text)
+	tree, ok := g.Parse(scan)
+	if !ok {
+		t.Fatal("not accepted")
+	}
+	for name, want := range map[string]string{"key": "abc", "value": "42", "note": ""} {
+		found := tree.Find(name)
+		if found == nil {
+			t.Errorf("%v: not found", name)
+			continue
+		}
+		if got := text[found.Start:found.End]; got != want {
+			t.Errorf("%v: want %q; but got %q", name, want, got)
+		}
+	}
+	if got := len(tree.FindAll("rule:tagWord")); got != 1 {
+		t.Errorf("want 1 tagWord; but got %v", got)
+	}
+	if tree.Find("missing") != nil {
+		t.Errorf("found a missing tag")
+	}
+	// the tag of an alternative that failed is not kept on the memoized
+	// tree of tagWord
+	g, err = LoadGrammar(`
+tagBack <- key:tagWord "=" tagWord / value:tagWord ";"
+tagWord <- [a-z]+
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm, err := Compile(g.Start())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []Expr{g, vm} {
+		tree, ok := e.Parse(NewScanner("abc;"))
+		if !ok {
+			t.Fatalf("%T: not accepted", e)
+		}
+		if found := tree.Find("key"); found != nil {
+			t.Errorf("%T: found key on %v", e, found.TagNames())
+		}
+		if found := tree.Find("value"); found == nil || found.End != 3 {
+			t.Errorf("%T: want value abc; but got %v", e, found)
+		}
+	}
+}
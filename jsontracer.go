@@ -0,0 +1,75 @@
+package peg
+
+import (
+	"encoding/json"
+	"io"
+)
+
+var _ Tracer = &JSONTracer{}
+
+// JSONTracer writes one JSON object per event and per line, for tools that
+// analyze or replay parses:
+//
+//	{"event":"enter","name":"oct","rule":true,"depth":1,"pos":4,"memo":"hit"}
+//	{"event":"exit","name":"oct","rule":true,"depth":1,"pos":4,"memo":"hit","ok":true,"end":7}
+type JSONTracer struct {
+	enc *json.Encoder
+	err error
+}
+
+type jsonEvent struct {
+	Event     string `json:"event"`
+	Name      string `json:"name"`
+	Rule      bool   `json:"rule,omitempty"`
+	Depth     int    `json:"depth"`
+	Pos       int    `json:"pos"`
+	Memo      string `json:"memo,omitempty"`
+	OK        *bool  `json:"ok,omitempty"`
+	End       *int   `json:"end,omitempty"`
+	Backtrack int    `json:"backtrack,omitempty"`
+}
+
+func NewJSONTracer(w io.Writer) *JSONTracer {
+	t := new(JSONTracer)
+	t.enc = json.NewEncoder(w)
+	return t
+}
+
+func (t *JSONTracer) Enter(ev TraceEvent) {
+	t.encode(newJSONEvent("enter", ev))
+}
+
+func (t *JSONTracer) Exit(ev TraceEvent) {
+	e := newJSONEvent("exit", ev)
+	e.OK = &ev.OK
+	if ev.OK {
+		e.End = &ev.End
+	}
+	e.Backtrack = ev.Backtrack
+	t.encode(e)
+}
+
+// Err returns the first error writing the trace. Later events are dropped.
+func (t *JSONTracer) Err() error {
+	return t.err
+}
+
+func newJSONEvent(kind string, ev TraceEvent) *jsonEvent {
+	e := &jsonEvent{
+		Event: kind,
+		Name:  ev.Name,
+		Rule:  ev.Rule != nil,
+		Depth: ev.Depth,
+		Pos:   ev.Pos,
+	}
+	if ev.Memo != MemoNone {
+		e.Memo = ev.Memo.String()
+	}
+	return e
+}
+
+func (t *JSONTracer) encode(e *jsonEvent) {
+	if t.err == nil {
+		t.err = t.enc.Encode(e)
+	}
+}
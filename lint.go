@@ -0,0 +1,325 @@
+package peg
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Shadow describes an alternative of a Choice that an earlier alternative
+// matches first, so that it wins for no input (Never) or only for some.
+type Shadow struct {
+	// Where locates the choice as the enclosing rule name followed by
+	// the child indexes leading from the rule body to the choice,
+	// e.g. "oct" or "expr/1/0".
+	Where string
+	// Alt is the index of the shadowed alternative.
+	Alt int
+	// By is the index of the earlier alternative that matches first.
+	By int
+	// Never is true if Alt can never win; otherwise it loses only for
+	// some of the inputs it accepts.
+	Never bool
+	// Exact is true if the result was derived from the languages of the
+	// alternatives, false if it was estimated by sampling.
+	Exact bool
+}
+
+func (s Shadow) String() string {
+	how := "partially shadowed"
+	if s.Never {
+		how = "never wins, shadowed"
+	}
+	if !s.Exact {
+		how += " (sampled)"
+	}
+	return fmt.Sprintf("%s: alternative %d %s by alternative %d", s.Where, s.Alt, how, s.By)
+}
+
+// lintSamples is the number of strings generated per alternative when the
+// languages cannot be compared exactly.
+const lintSamples = 64
+
+// LintChoices reports the Choice alternatives reachable from expr that are
+// shadowed by an earlier alternative. Alternatives built only from
+// literals, charclasses and sequences of them (possibly through rules) are
+// compared exactly; other alternatives are compared by sampling strings
+// from the later alternative and checking whether the earlier one
+// matches them.
+func LintChoices(expr Expr) []Shadow {
+	l := &linter{
+		rnd: rand.New(rand.NewSource(1)),
+	}
+	if _, ok := expr.(*Rule); !ok {
+		l.walk(expr, "")
+	}
+	for _, r := range rules(expr) {
+		if r.expr != nil {
+			l.walk(r.expr, r.name)
+		}
+	}
+	return l.shadows
+}
+
+type linter struct {
+	rnd     *rand.Rand
+	shadows []Shadow
+}
+
+func (l *linter) walk(e Expr, where string) {
+	if c, ok := e.(*Choice); ok {
+		l.choice(c, where)
+	}
+	if _, ok := e.(*Rule); ok {
+		return
+	}
+	for i, child := range children(e) {
+		l.walk(child, where+"/"+strconv.Itoa(i))
+	}
+}
+
+func (l *linter) choice(c *Choice, where string) {
+	sets := make([][]runeSet, len(c.exprs))
+	exact := make([]bool, len(c.exprs))
+	for i, e := range c.exprs {
+		sets[i], exact[i] = setSequence(e, make(map[*Rule]bool))
+	}
+	for j := 1; j < len(c.exprs); j++ {
+		var found *Shadow
+		for i := 0; i < j; i++ {
+			var s *Shadow
+			switch {
+			case alwaysMatches(c.exprs[i], make(map[*Rule]bool)):
+				s = &Shadow{Never: true, Exact: true}
+			case exact[i] && exact[j]:
+				s = shadowExact(sets[i], sets[j])
+			default:
+				s = l.shadowSampled(c.exprs[i], c.exprs[j])
+			}
+			if s == nil {
+				continue
+			}
+			s.Where = where
+			s.Alt = j
+			s.By = i
+			if s.Never {
+				found = s
+				break
+			}
+			if found == nil {
+				found = s
+			}
+		}
+		if found != nil {
+			l.shadows = append(l.shadows, *found)
+		}
+	}
+}
+
+// alwaysMatches reports whether e succeeds on every input: optionals,
+// repetitions without a lower bound, the empty literal and sequences of
+// those. Predicates are not, as they fail too.
+func alwaysMatches(e Expr, visiting map[*Rule]bool) bool {
+	switch e := e.(type) {
+	case *Optional:
+		return true
+	case *Repeat:
+		return !e.limit.lowervalid || e.limit.lower == 0
+	case *Literal:
+		return e.text == ""
+	case *Sequence:
+		for _, c := range e.exprs {
+			if !alwaysMatches(c, visiting) {
+				return false
+			}
+		}
+		return true
+	case *Tag:
+		return alwaysMatches(e.expr, visiting)
+	case *Expect:
+		return alwaysMatches(e.expr, visiting)
+	case *Rule:
+		if visiting[e] || e.expr == nil {
+			return false
+		}
+		visiting[e] = true
+		defer delete(visiting, e)
+		return alwaysMatches(e.expr, visiting)
+	default:
+		return false
+	}
+}
+
+// setSequence returns the language of e as a sequence of rune sets if e is
+// made only of literals, charclasses, sequences and rules of those.
+func setSequence(e Expr, visiting map[*Rule]bool) ([]runeSet, bool) {
+	switch e := e.(type) {
+	case *Literal:
+		if !utf8.ValidString(e.text) {
+			return nil, false
+		}
+		var seq []runeSet
+		for _, ch := range e.text {
+			seq = append(seq, runeSet{{ch, ch}})
+		}
+		return seq, true
+	case *Charclass:
+		set, ok := newRuneSet(e.set)
+		if !ok {
+			return nil, false
+		}
+		return []runeSet{set}, true
+	case *Sequence:
+		var seq []runeSet
+		for _, c := range e.exprs {
+			x, ok := setSequence(c, visiting)
+			if !ok {
+				return nil, false
+			}
+			seq = append(seq, x...)
+		}
+		return seq, true
+	case *Tag:
+		return setSequence(e.expr, visiting)
+	case *Expect:
+		return setSequence(e.expr, visiting)
+	case *Rule:
+		if visiting[e] || e.expr == nil {
+			return nil, false
+		}
+		visiting[e] = true
+		defer delete(visiting, e)
+		return setSequence(e.expr, visiting)
+	default:
+		return nil, false
+	}
+}
+
+// shadowExact compares the earlier alternative a with the later one b.
+// b loses on an input w in L(b) exactly when a prefix of w is in L(a).
+func shadowExact(a, b []runeSet) *Shadow {
+	if len(a) > len(b) {
+		return nil
+	}
+	never := true
+	for k := range a {
+		if a[k].intersect(b[k]).empty() {
+			return nil
+		}
+		if !b[k].subsetOf(a[k]) {
+			never = false
+		}
+	}
+	return &Shadow{Never: never, Exact: true}
+}
+
+func (l *linter) shadowSampled(a, b Expr) *Shadow {
+	var tried, lost int
+	for n := 0; n < lintSamples; n++ {
+		text, ok := l.sample(b, 0)
+		if !ok {
+			continue
+		}
+		if _, ok := b.Parse(NewScanner(text)); !ok {
+			continue
+		}
+		tried++
+		if _, ok := a.Parse(NewScanner(text)); ok {
+			lost++
+		}
+	}
+	if lost == 0 {
+		return nil
+	}
+	return &Shadow{Never: lost == tried}
+}
+
+// sampleDepth bounds rule recursion while generating samples.
+const sampleDepth = 16
+
+// sample generates a random string that e is likely to accept.
+func (l *linter) sample(e Expr, depth int) (string, bool) {
+	switch e := e.(type) {
+	case *Literal:
+		return e.text, true
+	case *Charclass:
+		ch, ok := l.sampleRune(e.set)
+		if !ok {
+			return "", false
+		}
+		return string(ch), true
+	case *Sequence:
+		var sb strings.Builder
+		for _, c := range e.exprs {
+			s, ok := l.sample(c, depth)
+			if !ok {
+				return "", false
+			}
+			sb.WriteString(s)
+		}
+		return sb.String(), true
+	case *Choice:
+		if len(e.exprs) == 0 {
+			return "", false
+		}
+		return l.sample(e.exprs[l.rnd.Intn(len(e.exprs))], depth)
+	case *Repeat:
+		lower, upper := 0, 3
+		if e.limit.lowervalid {
+			lower = e.limit.lower
+		}
+		if e.limit.uppervalid {
+			upper = e.limit.upper
+		} else {
+			upper = lower + 3
+		}
+		if upper < lower {
+			return "", false
+		}
+		var sb strings.Builder
+		for n := lower + l.rnd.Intn(upper-lower+1); n > 0; n-- {
+			s, ok := l.sample(e.expr, depth)
+			if !ok {
+				return "", false
+			}
+			sb.WriteString(s)
+		}
+		return sb.String(), true
+	case *Optional:
+		if l.rnd.Intn(2) == 0 {
+			return "", true
+		}
+		return l.sample(e.expr, depth)
+	case *And, *Not:
+		return "", true
+	case *Tag:
+		return l.sample(e.expr, depth)
+	case *Expect:
+		return l.sample(e.expr, depth)
+	case *Rule:
+		if depth >= sampleDepth || e.expr == nil {
+			return "", false
+		}
+		return l.sample(e.expr, depth+1)
+	default:
+		return "", false
+	}
+}
+
+func (l *linter) sampleRune(set RuneSubset) (rune, bool) {
+	if s, ok := newRuneSet(set); ok {
+		if s.empty() {
+			return 0, false
+		}
+		return s.nth(l.rnd.Int63n(s.size())), true
+	}
+	for n := 0; n < 256; n++ {
+		ch := rune(' ' + l.rnd.Intn('~'-' '+1))
+		if set.Within(ch) {
+			return ch, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,101 @@
+package peg
+
+import (
+	"testing"
+)
+
+func TestLintChoices(t *testing.T) {
+	digit := NewRule("digit")
+	digit.Define(NewCharclass(RuneRange{'0', '9'}))
+	word := NewRule("word")
+	word.Define(NewOneOrMore(NewCharclass(RuneRange{'a', 'z'})))
+
+	tests := []struct {
+		name string
+		g    Expr
+		want []Shadow
+	}{
+		{
+			name: "ordered",
+			g:    newIPv4PrefixGrammar(),
+		},
+		{
+			name: "never",
+			g: NewChoice(
+				digit,
+				NewSequence(NewCharclass(RuneRange{'1', '9'}), digit),
+			),
+			want: []Shadow{
+				{Where: "", Alt: 1, By: 0, Never: true, Exact: true},
+			},
+		},
+		{
+			name: "partial",
+			g: NewChoice(
+				NewSequence(NewLiteral("2"), NewCharclass(RuneRange{'0', '4'})),
+				NewSequence(NewLiteral("2"), digit, digit),
+			),
+			want: []Shadow{
+				{Where: "", Alt: 1, By: 0, Never: false, Exact: true},
+			},
+		},
+		{
+			name: "nullable",
+			g: NewChoice(
+				NewOptional(NewLiteral("a")),
+				NewLiteral("b"),
+			),
+			want: []Shadow{
+				{Where: "", Alt: 1, By: 0, Never: true, Exact: true},
+			},
+		},
+		{
+			name: "predicate",
+			g: NewChoice(
+				NewAnd(NewLiteral("a")),
+				NewLiteral("b"),
+			),
+		},
+		{
+			name: "predicates",
+			g: NewChoice(
+				NewSequence(NewNot(NewLiteral("b")), NewAnd(NewLiteral("c"))),
+				NewLiteral("b"),
+			),
+		},
+		{
+			name: "skipped optional",
+			g: NewChoice(
+				NewSequence(NewChoice(NewOptional(NewLiteral("a")), NewLiteral("b")), NewLiteral("c")),
+				NewSequence(NewLiteral("c"), NewLiteral("d")),
+			),
+			want: []Shadow{
+				{Where: "", Alt: 1, By: 0, Never: true, Exact: false},
+				{Where: "/0/0", Alt: 1, By: 0, Never: true, Exact: true},
+			},
+		},
+		{
+			name: "sampled",
+			g: NewChoice(
+				word,
+				NewSequence(word, NewLiteral("!")),
+			),
+			want: []Shadow{
+				{Where: "", Alt: 1, By: 0, Never: true, Exact: false},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := LintChoices(tc.g)
+			if len(got) != len(tc.want) {
+				t.Fatalf("want %v; but got %v", tc.want, got)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("want %v; but got %v", tc.want[i], got[i])
+				}
+			}
+		})
+	}
+}
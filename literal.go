@@ -13,14 +13,15 @@ func NewLiteral(text string) *Literal {
 }
 
 func (l *Literal) Parse(scan *Scanner) (*Tree, bool) {
-	t := NewTree(scan.Pos)
+	t := scan.newTree(scan.Pos)
 	m := len(l.text)
 	n := len(scan.Text)
 	for i := 0; i < m; i++ {
-		if scan.Pos >= n {
-			return t, false
-		}
-		if scan.Text[scan.Pos] != l.text[i] {
+		if scan.Pos >= n || scan.Text[scan.Pos] != l.text[i] {
+			scan.examine(scan.Pos + 1)
+			if scan.Pos >= n {
+				scan.expectLiteral(scan.Pos-i, l.text)
+			}
 			return t, false
 		}
 		scan.Pos++
@@ -29,5 +30,26 @@ func (l *Literal) Parse(scan *Scanner) (*Tree, bool) {
 		}
 		t.End = scan.Pos
 	}
+	scan.examine(scan.Pos)
 	return t, true
 }
+
+func (l *Literal) Match(scan *Scanner) bool {
+	m := len(l.text)
+	n := len(scan.Text)
+	for i := 0; i < m; i++ {
+		if scan.Pos >= n || scan.Text[scan.Pos] != l.text[i] {
+			scan.examine(scan.Pos + 1)
+			if scan.Pos >= n {
+				scan.expectLiteral(scan.Pos-i, l.text)
+			}
+			return false
+		}
+		scan.Pos++
+		if scan.Pos > scan.LPos {
+			scan.LPos = scan.Pos
+		}
+	}
+	scan.examine(scan.Pos)
+	return true
+}
@@ -0,0 +1,93 @@
+package peg
+
+var _ Expr = &literalSet{}
+
+// literalSet is an ordered choice of literals indexed by their first byte.
+// It returns the same tree as the Choice, with Index set to the literal
+// that matched, and reports the same longest match.
+type literalSet struct {
+	texts []string
+	index map[byte][]int
+	// empty is the index of the first empty literal, or -1. Literals after
+	// it are never tried.
+	empty int
+}
+
+// NewLiteralSet returns an ordered choice of the literals texts that finds
+// the literals to try by the first byte of the input. Optimize builds it
+// from choices of literals.
+func NewLiteralSet(texts ...string) Expr {
+	return newLiteralSet(texts)
+}
+
+func newLiteralSet(texts []string) *literalSet {
+	l := new(literalSet)
+	l.texts = texts
+	l.index = make(map[byte][]int)
+	l.empty = -1
+	for i, text := range texts {
+		if text == "" {
+			l.empty = i
+			break
+		}
+		l.index[text[0]] = append(l.index[text[0]], i)
+	}
+	return l
+}
+
+func (l *literalSet) Parse(scan *Scanner) (*Tree, bool) {
+	pos := scan.Pos
+	i, ok := l.find(scan)
+	if !ok {
+		return nil, false
+	}
+	t := scan.newTree(pos)
+	t.End = scan.Pos
+	t.Index = i
+	return t, true
+}
+
+func (l *literalSet) Match(scan *Scanner) bool {
+	_, ok := l.find(scan)
+	return ok
+}
+
+func (l *literalSet) find(scan *Scanner) (int, bool) {
+	pos := scan.Pos
+	// every literal looks at the first byte, or at the end of the input
+	scan.examine(pos + 1)
+	if pos < len(scan.Text) {
+		rest := scan.Text[pos:]
+		for _, i := range l.index[rest[0]] {
+			text := l.texts[i]
+			n := 0
+			for n < len(text) && n < len(rest) && text[n] == rest[n] {
+				n++
+			}
+			if pos+n > scan.LPos {
+				scan.LPos = pos + n
+			}
+			if n == len(text) {
+				scan.examine(pos + n)
+				scan.Pos = pos + n
+				return i, true
+			}
+			scan.examine(pos + n + 1)
+			if n == len(rest) {
+				scan.expectLiteral(pos, text)
+			}
+		}
+	} else if scan.expect != nil {
+		last := len(l.texts)
+		if l.empty >= 0 {
+			last = l.empty
+		}
+		for _, text := range l.texts[:last] {
+			scan.expectLiteral(pos, text)
+		}
+	}
+	if l.empty >= 0 {
+		return l.empty, true
+	}
+	return 0, false
+}
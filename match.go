@@ -0,0 +1,43 @@
+package peg
+
+// Matcher is implemented by expressions that can recognize input without
+// building trees. All expressions of this package implement it.
+type Matcher interface {
+	Match(scan *Scanner) bool
+}
+
+// Match recognizes text with expr without building any tree. Rule results
+// are still memoized and the scanner reports the longest match as after
+// Parse. Expressions that do not implement Matcher are parsed and their
+// trees discarded.
+func Match(expr Expr, text string, opts ...ScannerOption) (*Scanner, bool) {
+	scan := NewScanner(text, opts...)
+	return scan, scan.match(expr)
+}
+
+// match is the counterpart of parse for recognition.
+func (s *Scanner) match(e Expr) bool {
+	if !s.step() {
+		return false
+	}
+	if s.traceExprs {
+		if _, ok := e.(*Rule); !ok {
+			return s.traceMatch(nil, e, func(s *Scanner) bool {
+				return matchExpr(s, e)
+			})
+		}
+	}
+	if m, ok := e.(Matcher); ok {
+		return m.Match(s)
+	}
+	_, ok := e.Parse(s)
+	return ok
+}
+
+func matchExpr(s *Scanner, e Expr) bool {
+	if m, ok := e.(Matcher); ok {
+		return m.Match(s)
+	}
+	_, ok := e.Parse(s)
+	return ok
+}
@@ -0,0 +1,236 @@
+package peg
+
+// memoTable stores rule results by input position and rule ID.
+type memoTable interface {
+	get(pos, id int) (Memo, bool)
+	// set stores memo and reports whether the entry is new.
+	set(pos, id int, memo Memo) bool
+	del(pos, id int)
+	// reset empties the table for a text of n bytes.
+	reset(n int)
+	// each calls fn for every entry; put stores an entry as given. They
+	// are used to move entries when the text is edited.
+	each(fn func(pos, id int, c memoCell))
+	put(pos, id int, c memoCell)
+}
+
+// memoChunk is the number of positions per chunk of a denseMemo column.
+const memoChunk = 8
+
+// memoBlock is the number of chunks allocated at once.
+const memoBlock = 16
+
+// memoCell holds Memo.Pos+1 in end, so that the zero cell is empty. shift
+// is the distance the entry was moved by Scanner.Edit that its tree does
+// not reflect yet.
+type memoCell struct {
+	end   int
+	reach int
+	lpos  int
+	shift int
+	tree  *Tree
+}
+
+func newMemoCell(memo Memo) memoCell {
+	return memoCell{
+		end:   memo.Pos + 1,
+		reach: max(memo.Reach, memo.Pos),
+		lpos:  max(memo.lpos, memo.Pos),
+		tree:  memo.Tree,
+	}
+}
+
+// memo returns the entry, moving its tree first if needed.
+func (c *memoCell) memo() Memo {
+	if c.shift != 0 {
+		if c.tree != nil {
+			c.tree = c.tree.shift(c.shift)
+		}
+		c.shift = 0
+	}
+	return Memo{Pos: c.end - 1, Tree: c.tree, Reach: c.reach, lpos: c.lpos}
+}
+
+// denseMemo keeps one column per rule ID, split into chunks of positions
+// that are allocated on first use.
+type denseMemo struct {
+	nchunk int
+	cols   [][]*[memoChunk]memoCell
+	// free holds cleared chunks kept by reset for reuse.
+	free []*[memoChunk]memoCell
+}
+
+func newDenseMemo(n int) *denseMemo {
+	m := new(denseMemo)
+	m.nchunk = n/memoChunk + 1
+	return m
+}
+
+func (m *denseMemo) get(pos, id int) (Memo, bool) {
+	if id >= len(m.cols) {
+		return Memo{}, false
+	}
+	col := m.cols[id]
+	if pos/memoChunk >= len(col) {
+		return Memo{}, false
+	}
+	chunk := col[pos/memoChunk]
+	if chunk == nil {
+		return Memo{}, false
+	}
+	cell := &chunk[pos%memoChunk]
+	if cell.end == 0 {
+		return Memo{}, false
+	}
+	return cell.memo(), true
+}
+
+func (m *denseMemo) set(pos, id int, memo Memo) bool {
+	cell := m.cell(pos, id)
+	added := cell.end == 0
+	*cell = newMemoCell(memo)
+	return added
+}
+
+func (m *denseMemo) put(pos, id int, c memoCell) {
+	*m.cell(pos, id) = c
+}
+
+// cell returns the cell of pos and id, allocating it if needed.
+func (m *denseMemo) cell(pos, id int) *memoCell {
+	for id >= len(m.cols) {
+		m.cols = append(m.cols, nil)
+	}
+	col := m.cols[id]
+	if col == nil {
+		col = make([]*[memoChunk]memoCell, m.nchunk)
+		m.cols[id] = col
+	}
+	for pos/memoChunk >= len(col) {
+		col = append(col, nil)
+		m.cols[id] = col
+	}
+	chunk := col[pos/memoChunk]
+	if chunk == nil {
+		if len(m.free) == 0 {
+			m.grow()
+		}
+		n := len(m.free)
+		chunk = m.free[n-1]
+		m.free = m.free[:n-1]
+		col[pos/memoChunk] = chunk
+	}
+	return &chunk[pos%memoChunk]
+}
+
+// grow allocates up to memoBlock chunks, no more than a column has, in
+// one block, which is cheaper than allocating them one by one.
+func (m *denseMemo) grow() {
+	block := make([][memoChunk]memoCell, min(m.nchunk, memoBlock))
+	for i := range block {
+		m.free = append(m.free, &block[i])
+	}
+}
+
+func (m *denseMemo) del(pos, id int) {
+	if id >= len(m.cols) || pos/memoChunk >= len(m.cols[id]) {
+		return
+	}
+	chunk := m.cols[id][pos/memoChunk]
+	if chunk != nil {
+		chunk[pos%memoChunk] = memoCell{}
+	}
+}
+
+func (m *denseMemo) reset(n int) {
+	m.nchunk = n/memoChunk + 1
+	for _, col := range m.cols {
+		for i, chunk := range col {
+			if chunk != nil {
+				*chunk = [memoChunk]memoCell{}
+				m.free = append(m.free, chunk)
+				col[i] = nil
+			}
+		}
+	}
+}
+
+func (m *denseMemo) each(fn func(pos, id int, c memoCell)) {
+	for id, col := range m.cols {
+		for i, chunk := range col {
+			if chunk == nil {
+				continue
+			}
+			for j, c := range chunk {
+				if c.end != 0 {
+					fn(i*memoChunk+j, id, c)
+				}
+			}
+		}
+	}
+}
+
+// mapMemo is the backend selected by WithMapMemo. It keeps the nested
+// maps keyed by position and rule name that the scanner used before the
+// dense table, and finds names and columns through the scanner.
+type mapMemo struct {
+	scan *Scanner
+	m    map[int]map[string]memoCell
+}
+
+func newMapMemo(scan *Scanner) *mapMemo {
+	return &mapMemo{scan: scan, m: make(map[int]map[string]memoCell)}
+}
+
+func (m *mapMemo) get(pos, id int) (Memo, bool) {
+	x, ok := m.m[pos]
+	if !ok {
+		return Memo{}, false
+	}
+	name := m.scan.cols[id].name
+	c, ok := x[name]
+	if !ok {
+		return Memo{}, false
+	}
+	if c.shift == 0 {
+		return c.memo(), true
+	}
+	memo := c.memo()
+	x[name] = c
+	return memo, true
+}
+
+func (m *mapMemo) set(pos, id int, memo Memo) bool {
+	_, ok := m.m[pos][m.scan.cols[id].name]
+	m.put(pos, id, newMemoCell(memo))
+	return !ok
+}
+
+func (m *mapMemo) put(pos, id int, c memoCell) {
+	x, ok := m.m[pos]
+	if !ok {
+		x = make(map[string]memoCell)
+		m.m[pos] = x
+	}
+	x[m.scan.cols[id].name] = c
+}
+
+func (m *mapMemo) del(pos, id int) {
+	x := m.m[pos]
+	delete(x, m.scan.cols[id].name)
+	if len(x) == 0 {
+		delete(m.m, pos)
+	}
+}
+
+func (m *mapMemo) reset(n int) {
+	clear(m.m)
+}
+
+func (m *mapMemo) each(fn func(pos, id int, c memoCell)) {
+	for pos, x := range m.m {
+		for name, c := range x {
+			fn(pos, m.scan.colOf[name], c)
+		}
+	}
+}
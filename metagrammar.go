@@ -0,0 +1,400 @@
+package peg
+
+import (
+	"unicode"
+)
+
+// NewPEGGrammar returns the grammar of the .peg language, whose trees
+// ASTBuilder turns into an ast.Program.
+func NewPEGGrammar() Expr {
+	program := NewRule("program")
+	statement := NewRule("statement")
+	annotation := NewRule("annotation")
+	expression := NewRule("expression")
+	sequence := NewRule("sequence")
+	term := NewRule("term")
+	labeled := NewRule("labeled")
+	andpred := NewRule("andpred")
+	notpred := NewRule("notpred")
+	factor := NewRule("factor")
+	repeat := NewRule("repeat")
+	primary := NewRule("primary")
+	tag := NewRule("tag")
+	charclass := NewRule("charclass")
+	refident := NewRule("refident")
+	ident := NewRule("ident")
+	literal := NewRule("literal")
+	Range := NewRule("Range")
+	Char := NewRule("Char")
+	digits := NewRule("digits")
+	S0 := NewRule("S0")
+	space := NewRule("space")
+	comment := NewRule("comment")
+
+	// error messages name what was expected in the terms of the language
+	// and leave out the whitespace that may come almost anywhere
+	statement.SetDisplayName("rule definition")
+	annotation.SetDisplayName("annotation")
+	expression.SetDisplayName("expression")
+	sequence.SetDisplayName("expression")
+	term.SetDisplayName("expression")
+	factor.SetDisplayName("expression")
+	primary.SetDisplayName("expression")
+	charclass.SetDisplayName("character class")
+	ident.SetDisplayName("identifier")
+	literal.SetDisplayName("literal")
+	Char.SetDisplayName("character")
+	digits.SetDisplayName("number")
+	S0.Hide()
+	space.Hide()
+	comment.Hide()
+
+	// program <- S0 (statement S0)* EOT
+	program.Define(NewSequence(
+		S0,
+		NewZeroOrMore(NewSequence(
+			statement,
+			S0,
+		)),
+		EOT,
+	))
+
+	// statement <- annotation* ident S0 (literal S0)? "<-" S0 expression
+	statement.Define(NewSequence(
+		NewZeroOrMore(annotation),
+		ident,
+		S0,
+		NewOptional(NewSequence(
+			literal,
+			S0,
+		)),
+		NewLiteral("<-"),
+		S0,
+		expression,
+	))
+
+	// annotation <- "@" ident S0
+	annotation.Define(NewSequence(
+		NewLiteral("@"),
+		ident,
+		S0,
+	))
+
+	// expression <- sequence ("/" S0 sequence)*
+	expression.Define(NewSequence(
+		sequence,
+		NewZeroOrMore(NewSequence(
+			NewLiteral("/"),
+			S0,
+			sequence,
+		)),
+	))
+
+	// sequence <- (term S0)+
+	sequence.Define(NewOneOrMore(
+		NewSequence(
+			term,
+			S0,
+		),
+	))
+
+	// term <-
+	//   labeled /
+	//   andpred /
+	//   notpred /
+	//   factor
+	term.Define(NewChoice(
+		labeled,
+		andpred,
+		notpred,
+		factor,
+	))
+
+	// labeled <- ident ":" term
+	labeled.Define(NewSequence(
+		ident,
+		NewLiteral(":"),
+		term,
+	))
+
+	// andpred <- "&" factor
+	andpred.Define(NewSequence(
+		NewLiteral("&"),
+		factor,
+	))
+
+	// notpred <- "!" factor
+	notpred.Define(NewSequence(
+		NewLiteral("!"),
+		factor,
+	))
+
+	// factor <- primary ("?" / "*" / "+" / repeat)?
+	factor.Define(NewSequence(
+		primary,
+		NewOptional(NewChoice(
+			NewLiteral("?"),
+			NewLiteral("*"),
+			NewLiteral("+"),
+			repeat,
+		)),
+	))
+
+	// repeat <- "{" S0 (
+	//   digits S0 "," S0 digits /
+	//   digits S0 "," /
+	//   "," S0 digits /
+	//   digits
+	//   ) S0 "}"
+	repeat.Define(NewSequence(
+		NewLiteral("{"),
+		S0,
+		NewChoice(
+			NewSequence(
+				digits,
+				S0,
+				NewLiteral(","),
+				S0,
+				digits,
+			),
+			NewSequence(
+				digits,
+				S0,
+				NewLiteral(","),
+			),
+			NewSequence(
+				NewLiteral(","),
+				S0,
+				digits,
+			),
+			digits,
+		),
+		S0,
+		NewLiteral("}"),
+	))
+
+	// primary <-
+	//   "(" S0 expression ")" /
+	//   "EOT" /
+	//   charclass /
+	//   refident /
+	//   literal /
+	//   "." /
+	//   tag
+	primary.Define(NewChoice(
+		NewSequence(
+			NewLiteral("("),
+			S0,
+			expression,
+			NewLiteral(")"),
+		),
+		NewLiteral("EOT"),
+		charclass,
+		refident,
+		literal,
+		NewLiteral("."),
+		tag,
+	))
+
+	// tag <- "@" ident "(" S0 expression ")"
+	tag.Define(NewSequence(
+		NewLiteral("@"),
+		ident,
+		NewLiteral("("),
+		S0,
+		expression,
+		NewLiteral(")"),
+	))
+
+	// charclass <- "[" "^"? (!"]" Range)+ "]"
+	charclass.Define(NewSequence(
+		NewLiteral("["),
+		NewOptional(NewLiteral("^")),
+		NewOneOrMore(NewSequence(
+			NewNot(NewLiteral("]")),
+			Range,
+		)),
+		NewLiteral("]"),
+	))
+
+	// refident <- ident !(S0 (literal S0)? "<-")
+	refident.Define(NewSequence(
+		ident,
+		NewNot(NewSequence(
+			S0,
+			NewOptional(NewSequence(
+				literal,
+				S0,
+			)),
+			NewLiteral("<-"),
+		)),
+	))
+
+	// ident <- (letter / "_") (letter / digit / "_" / "-")*
+	//
+	// Letters and digits are those of Unicode, as in Go identifiers. The
+	// rest of an identifier is labeled, since the charclass is too large
+	// to list in an error message.
+	ident.Define(NewSequence(
+		NewCharclass(
+			RuneUnion{
+				RuneTable{unicode.Letter},
+				RuneValue('_'),
+			},
+		),
+		NewZeroOrMore(
+			NewExpect(NewCharclass(
+				RuneUnion{
+					RuneTable{unicode.Letter},
+					RuneTable{unicode.Digit},
+					RuneValue('_'),
+					RuneValue('-'),
+				},
+			), "identifier"),
+		),
+	))
+
+	// literal <-
+	//   '"' (!'"' Char)* '"' /
+	//   "'' (!"'" Char)* "'"
+	literal.Define(NewChoice(
+		NewSequence(
+			NewLiteral("\""),
+			NewZeroOrMore(NewSequence(
+				NewNot(NewLiteral("\"")),
+				Char,
+			)),
+			NewLiteral("\""),
+		),
+		NewSequence(
+			NewLiteral("'"),
+			NewZeroOrMore(NewSequence(
+				NewNot(NewLiteral("'")),
+				Char,
+			)),
+			NewLiteral("'"),
+		),
+	))
+
+	// Range <- Char "-" Char / Char
+	Range.Define(NewChoice(
+		NewSequence(
+			Char,
+			NewLiteral("-"),
+			Char,
+		),
+		Char,
+	))
+
+	// Char <-
+	//   "\\" [abefnrtv'"\[\]\\] /
+	//   "\\" [0-3] [0-7] [0-7] /
+	//   "\\" [0-7] [0-7]? /
+	//   "\\" "-" /
+	//   !"\\" .
+	Char.Define(NewChoice(
+		NewSequence(
+			NewLiteral("\\"),
+			NewCharclass(RuneUnion{
+				RuneValue('a'),
+				RuneValue('b'),
+				RuneValue('e'),
+				RuneValue('f'),
+				RuneValue('n'),
+				RuneValue('r'),
+				RuneValue('t'),
+				RuneValue('v'),
+				RuneValue('\''),
+				RuneValue('"'),
+				RuneValue('['),
+				RuneValue(']'),
+				RuneValue('\\'),
+			}),
+		),
+		NewSequence(
+			NewLiteral("\\"),
+			NewCharclass(RuneRange{'0', '3'}),
+			NewCharclass(RuneRange{'0', '7'}),
+			NewCharclass(RuneRange{'0', '7'}),
+		),
+		NewSequence(
+			NewLiteral("\\"),
+			NewCharclass(RuneRange{'0', '7'}),
+			NewOptional(
+				NewCharclass(RuneRange{'0', '7'}),
+			),
+		),
+		NewSequence(
+			NewLiteral("\\"),
+			NewLiteral("-"),
+		),
+		NewSequence(
+			NewNot(NewLiteral("\\")),
+			Any,
+		),
+	))
+
+	// digits <- [1-9] [0-9]* / "0"
+	digits.Define(NewChoice(
+		NewSequence(
+			NewCharclass(RuneRange{'1', '9'}),
+			NewZeroOrMore(
+				NewCharclass(RuneRange{'0', '9'}),
+			),
+		),
+		NewLiteral("0"),
+	))
+
+	// S0 <- (space / comment)*
+	S0.Define(NewZeroOrMore(NewChoice(
+		space,
+		comment,
+	)))
+
+	// space <- [ \t\n\r]
+	space.Define(NewCharclass(
+		RuneUnion{
+			RuneValue(' '),
+			RuneValue('\t'),
+			RuneValue('\n'),
+			RuneValue('\r'),
+		},
+	))
+
+	// comment <-
+	//   "#" (![\n\r] .)* /
+	//   "//" (![\n\r] .)* /
+	//   "/*" (!"*/" .)* "*/"
+	comment.Define(NewChoice(
+		NewSequence(
+			NewLiteral("#"),
+			NewZeroOrMore(NewSequence(
+				NewNot(NewCharclass(RuneUnion{
+					RuneValue('\n'),
+					RuneValue('\r'),
+				})),
+				Any,
+			)),
+		),
+		NewSequence(
+			NewLiteral("//"),
+			NewZeroOrMore(NewSequence(
+				NewNot(NewCharclass(RuneUnion{
+					RuneValue('\n'),
+					RuneValue('\r'),
+				})),
+				Any,
+			)),
+		),
+		NewSequence(
+			NewLiteral("/*"),
+			NewZeroOrMore(NewSequence(
+				NewNot(NewLiteral("*/")),
+				Any,
+			)),
+			NewLiteral("*/"),
+		),
+	))
+
+	return program
+}
@@ -13,7 +13,30 @@ func NewNot(expr Expr) *Not {
 }
 
 func (n *Not) Parse(scan *Scanner) (*Tree, bool) {
-	drop := NewScanner(scan.Text[scan.Pos:])
-	_, ok := n.expr.Parse(drop)
+	pos, lpos := scan.Pos, scan.LPos
+	if scan.expect != nil {
+		scan.expect.neg++
+	}
+	_, ok := scan.parse(n.expr)
+	if scan.expect != nil {
+		scan.expect.neg--
+	}
+	scan.Pos, scan.LPos = pos, lpos
+	if scan.err != nil {
+		return nil, false
+	}
 	return nil, !ok
 }
+
+func (n *Not) Match(scan *Scanner) bool {
+	pos, lpos := scan.Pos, scan.LPos
+	if scan.expect != nil {
+		scan.expect.neg++
+	}
+	ok := scan.match(n.expr)
+	if scan.expect != nil {
+		scan.expect.neg--
+	}
+	scan.Pos, scan.LPos = pos, lpos
+	return scan.err == nil && !ok
+}
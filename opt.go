@@ -14,10 +14,19 @@ func NewOptional(expr Expr) *Optional {
 
 func (o *Optional) Parse(scan *Scanner) (*Tree, bool) {
 	pos := scan.Pos
-	t, ok := o.expr.Parse(scan)
+	t, ok := scan.parse(o.expr)
 	if !ok {
 		scan.Pos = pos
-		return nil, true
+		return nil, scan.err == nil
 	}
 	return t, true
 }
+
+func (o *Optional) Match(scan *Scanner) bool {
+	pos := scan.Pos
+	if !scan.match(o.expr) {
+		scan.Pos = pos
+		return scan.err == nil
+	}
+	return true
+}
@@ -0,0 +1,207 @@
+package peg
+
+// tinyRuleSize is the largest number of expressions in the definition of
+// a rule that Optimize inlines.
+const tinyRuleSize = 4
+
+// Optimize returns a copy of the grammar reachable from expr that accepts
+// the same language and reports the same longest match. Nested sequences
+// and choices are flattened, adjacent charclass alternatives are merged
+// into one charclass, adjacent literal alternatives are matched as a set,
+// and tiny rules made only of literals and charclasses are inlined.
+//
+// The trees of rules built from a Tag, and of every rule they reach, are
+// kept as they are. Other trees may lose levels or alternative indexes, so
+// the result suits recognizers and grammars whose structure is read
+// through tags.
+func Optimize(expr Expr) Expr {
+	o := &optimizer{
+		keep:  make(map[*Rule]bool),
+		rules: make(map[*Rule]*Rule),
+	}
+	for _, r := range rules(expr) {
+		if r.expr != nil && hasTag(r.expr, make(map[*Rule]bool)) {
+			for _, x := range rules(r) {
+				o.keep[x] = true
+			}
+		}
+	}
+	keep := false
+	if _, ok := expr.(*Rule); !ok {
+		keep = hasTag(expr, make(map[*Rule]bool))
+		o.keepTagged(expr)
+	}
+	expr = o.expr(expr, keep)
+	number(expr)
+	return expr
+}
+
+type optimizer struct {
+	keep  map[*Rule]bool
+	rules map[*Rule]*Rule
+}
+
+// keepTagged keeps the rules reached from the Tags of an expression that
+// is not a rule.
+func (o *optimizer) keepTagged(e Expr) {
+	switch e := e.(type) {
+	case *Rule:
+		return
+	case *Tag:
+		for _, r := range rules(e.expr) {
+			o.keep[r] = true
+		}
+		return
+	}
+	for _, c := range children(e) {
+		o.keepTagged(c)
+	}
+}
+
+func (o *optimizer) rule(r *Rule) *Rule {
+	if nr, ok := o.rules[r]; ok {
+		return nr
+	}
+	nr := r.copy()
+	o.rules[r] = nr
+	if r.expr != nil {
+		nr.expr = o.expr(r.expr, o.keep[r])
+	}
+	return nr
+}
+
+// tiny reports whether r is small enough to inline and built only of
+// literals and charclasses.
+func (o *optimizer) tiny(r *Rule) bool {
+	if o.keep[r] || r.expr == nil || r.display != "" || r.hidden {
+		return false
+	}
+	n := 0
+	var leaves func(Expr) bool
+	leaves = func(e Expr) bool {
+		n++
+		switch e.(type) {
+		case *Rule, *Tag, *And, *Not:
+			return false
+		case *Literal, *Charclass:
+		case *Sequence, *Choice, *Repeat, *Optional:
+		default:
+			return false
+		}
+		for _, c := range children(e) {
+			if !leaves(c) {
+				return false
+			}
+		}
+		return n <= tinyRuleSize
+	}
+	return leaves(r.expr)
+}
+
+// expr optimizes e. If keep is set, the structure of e is copied as it
+// is and only the rules it refers to are optimized.
+func (o *optimizer) expr(e Expr, keep bool) Expr {
+	switch e := e.(type) {
+	case *Rule:
+		if !keep && o.tiny(e) {
+			return o.expr(e.expr, false)
+		}
+		return o.rule(e)
+	case *Tag:
+		return NewTag(e.name, o.expr(e.expr, true))
+	case *Expect:
+		return NewExpect(o.expr(e.expr, keep), e.msg)
+	case *Sequence:
+		var exprs []Expr
+		for _, c := range e.exprs {
+			c = o.expr(c, keep)
+			if s, ok := c.(*Sequence); ok && !keep {
+				exprs = append(exprs, s.exprs...)
+			} else {
+				exprs = append(exprs, c)
+			}
+		}
+		if len(exprs) == 1 && !keep {
+			return exprs[0]
+		}
+		return NewSequence(exprs...)
+	case *Choice:
+		var exprs []Expr
+		for _, c := range e.exprs {
+			c = o.expr(c, keep)
+			if s, ok := c.(*Choice); ok && !keep {
+				exprs = append(exprs, s.exprs...)
+			} else {
+				exprs = append(exprs, c)
+			}
+		}
+		if keep {
+			return NewChoice(exprs...)
+		}
+		exprs = mergeAlternatives(exprs)
+		if len(exprs) == 1 {
+			return exprs[0]
+		}
+		return NewChoice(exprs...)
+	case *Repeat:
+		return NewRepeat(o.expr(e.expr, keep), e.limit)
+	case *Optional:
+		return NewOptional(o.expr(e.expr, keep))
+	case *And:
+		return NewAnd(o.expr(e.expr, keep))
+	case *Not:
+		return NewNot(o.expr(e.expr, keep))
+	default:
+		return e
+	}
+}
+
+// mergeAlternatives merges runs of charclass alternatives into one
+// charclass and runs of literal alternatives into a literal set.
+func mergeAlternatives(exprs []Expr) []Expr {
+	var list []Expr
+	for i := 0; i < len(exprs); {
+		j := i + 1
+		switch exprs[i].(type) {
+		case *Charclass:
+			var set RuneUnion
+			for ; j < len(exprs); j++ {
+				if _, ok := exprs[j].(*Charclass); !ok {
+					break
+				}
+			}
+			if j-i == 1 {
+				break
+			}
+			for _, e := range exprs[i:j] {
+				if u, ok := e.(*Charclass).set.(RuneUnion); ok {
+					set = append(set, u...)
+				} else {
+					set = append(set, e.(*Charclass).set)
+				}
+			}
+			list = append(list, NewCharclass(set))
+			i = j
+			continue
+		case *Literal:
+			var texts []string
+			for ; j < len(exprs); j++ {
+				if _, ok := exprs[j].(*Literal); !ok {
+					break
+				}
+			}
+			if j-i == 1 {
+				break
+			}
+			for _, e := range exprs[i:j] {
+				texts = append(texts, e.(*Literal).text)
+			}
+			list = append(list, newLiteralSet(texts))
+			i = j
+			continue
+		}
+		list = append(list, exprs[i])
+		i = j
+	}
+	return list
+}
@@ -0,0 +1,170 @@
+package peg
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// randomGrammar extends randomRegular with predicates, tags and rules.
+func randomGrammar(rnd *rand.Rand, depth int) Expr {
+	if depth == 0 {
+		return randomRegular(rnd, 0)
+	}
+	switch rnd.Intn(10) {
+	case 0:
+		return NewNot(randomGrammar(rnd, depth-1))
+	case 1:
+		return NewAnd(randomGrammar(rnd, depth-1))
+	case 2:
+		return NewTag("t", randomGrammar(rnd, depth-1))
+	case 3, 4:
+		// rules are memoized by name, so each needs its own.
+		r := NewRule(fmt.Sprintf("r%d", rnd.Int()))
+		r.Define(randomGrammar(rnd, depth-1))
+		return r
+	case 5:
+		return NewChoice(randomGrammar(rnd, depth-1), randomGrammar(rnd, depth-1), randomGrammar(rnd, depth-1))
+	case 6:
+		return NewSequence(randomGrammar(rnd, depth-1), randomGrammar(rnd, depth-1))
+	default:
+		return randomRegular(rnd, depth)
+	}
+}
+
+func TestOptimizeProperty(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for n := 0; n < 2000; n++ {
+		g := randomGrammar(rnd, 4)
+		o := Optimize(g)
+		for k := 0; k < 50; k++ {
+			b := make([]byte, rnd.Intn(8))
+			for i := range b {
+				b[i] = "abcd"[rnd.Intn(4)]
+			}
+			text := string(b)
+			want, wok := Match(g, text)
+			got, gok := Match(o, text)
+			if gok != wok || (wok && got.Pos != want.Pos) || got.LPos != want.LPos {
+				t.Fatalf("%q: %s: want %v %v %v; but got %v %v %v", text, dump(g), wok, want.Pos, want.LPos, gok, got.Pos, got.LPos)
+			}
+		}
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	t.Run("charclass", func(t *testing.T) {
+		g := Optimize(NewChoice(
+			NewCharclass(RuneValue('a')),
+			NewChoice(NewCharclass(RuneRange{'0', '9'}), NewCharclass(RuneValue('_'))),
+		))
+		c, ok := g.(*Charclass)
+		if !ok {
+			t.Fatalf("want *Charclass; but got %T", g)
+		}
+		for _, ch := range "a5_" {
+			if !c.set.Within(ch) {
+				t.Errorf("%q is not in the merged class", ch)
+			}
+		}
+	})
+	t.Run("sequence", func(t *testing.T) {
+		g := Optimize(NewSequence(NewSequence(NewLiteral("a")), NewSequence(NewLiteral("b"), NewLiteral("c"))))
+		s, ok := g.(*Sequence)
+		if !ok || len(s.exprs) != 3 {
+			t.Fatalf("want a flat sequence; but got %#v", g)
+		}
+	})
+	t.Run("literals", func(t *testing.T) {
+		g := NewChoice(NewLiteral("ab"), NewLiteral("a"), NewLiteral("abc"), NewLiteral(""), NewLiteral("b"))
+		o := Optimize(g)
+		if _, ok := o.(*literalSet); !ok {
+			t.Fatalf("want *literalSet; but got %T", o)
+		}
+		for _, text := range []string{"abc", "ax", "b", "", "c"} {
+			want := NewScanner(text)
+			wt, wok := g.Parse(want)
+			got := NewScanner(text)
+			gt, gok := o.Parse(got)
+			if gok != wok || got.Pos != want.Pos || got.LPos != want.LPos || !sameTree(gt, wt) {
+				t.Errorf("%q: want %v %v %v; but got %v %v %v", text, wok, want.Pos, want.LPos, gok, got.Pos, got.LPos)
+			}
+		}
+	})
+	t.Run("inline", func(t *testing.T) {
+		digit := NewRule("digit")
+		digit.Define(NewCharclass(RuneRange{'0', '9'}))
+		num := NewRule("num")
+		num.Define(NewOneOrMore(digit))
+		g := Optimize(num).(*Rule)
+		r, ok := g.expr.(*Repeat)
+		if !ok {
+			t.Fatalf("want *Repeat; but got %T", g.expr)
+		}
+		if _, ok := r.expr.(*Charclass); !ok {
+			t.Errorf("want digit inlined; but got %T", r.expr)
+		}
+	})
+	t.Run("hidden", func(t *testing.T) {
+		space := NewRule("space")
+		space.Define(NewCharclass(RuneValue(' ')))
+		space.Hide()
+		list := NewRule("list")
+		list.Define(NewOneOrMore(NewSequence(NewLiteral("a"), space)))
+		g := Optimize(list).(*Rule)
+		s := g.expr.(*Repeat).expr.(*Sequence)
+		if _, ok := s.exprs[1].(*Rule); !ok {
+			t.Errorf("want the hidden rule kept; but got %T", s.exprs[1])
+		}
+	})
+	t.Run("tagged", func(t *testing.T) {
+		digit := NewRule("digit")
+		digit.Define(NewChoice(NewCharclass(RuneRange{'0', '4'}), NewCharclass(RuneRange{'5', '9'})))
+		pair := NewRule("pair")
+		pair.Define(NewTag("pair", NewSequence(NewSequence(digit, NewLiteral(",")), digit)))
+		list := NewRule("list")
+		list.Define(NewSequence(NewSequence(pair), NewZeroOrMore(NewSequence(NewLiteral(";"), pair))))
+		var opair Expr
+		for _, r := range rules(Optimize(list)) {
+			if r.name == "pair" {
+				opair = r
+			}
+		}
+		for _, text := range []string{"1,2", "1,2;3,9", "1,2;x"} {
+			want := NewScanner(text)
+			wt, wok := pair.Parse(want)
+			got := NewScanner(text)
+			ot, gok := opair.Parse(got)
+			if gok != wok || !sameTree(ot, wt) {
+				t.Errorf("%q: tree of the tagged rule changed", text)
+			}
+		}
+	})
+}
+
+func TestOptimizeIPv4(t *testing.T) {
+	g := Optimize(newIPv4PrefixGrammar())
+	for _, text := range []string{"192.168.30.254/24", "192.168.30.254", "256.1.1.1/8", "10.0.0.1/33"} {
+		want, wok := Match(newIPv4PrefixGrammar(), text)
+		got, gok := Match(g, text)
+		if gok != wok || got.LPos != want.LPos {
+			t.Errorf("%q: want %v %v; but got %v %v", text, wok, want.LPos, gok, got.LPos)
+		}
+	}
+}
+
+func dump(e Expr) string {
+	switch e := e.(type) {
+	case *Literal:
+		return fmt.Sprintf("%q", e.text)
+	case *Charclass:
+		return fmt.Sprintf("[%v]", e.set)
+	case *Rule:
+		return "r(" + dump(e.expr) + ")"
+	}
+	s := fmt.Sprintf("%T(", e)
+	for _, c := range children(e) {
+		s += dump(c) + " "
+	}
+	return s + ")"
+}
@@ -0,0 +1,104 @@
+package peg
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// Parser parses texts with a grammar built once. It is safe for concurrent
+// use: each parse runs on its own Scanner, and scanners are reset and
+// pooled between parses so that their memo tables are reused.
+// The grammar must not change while the Parser is in use; see Expr.
+type Parser struct {
+	expr Expr
+	opts []ScannerOption
+	pool sync.Pool
+}
+
+// Result is the outcome of one text of Parser.ParseAll.
+type Result struct {
+	Tree *Tree
+	Err  error
+}
+
+// NewParser returns a parser for expr whose scanners are created with
+// opts. The options are shared by all parses, so WithArena, whose arena
+// cannot be used by several scanners at once, must not be given, and
+// statistics collected by WithStats are discarded.
+func NewParser(expr Expr, opts ...ScannerOption) *Parser {
+	p := new(Parser)
+	p.expr = expr
+	p.opts = opts
+	p.pool.New = func() any {
+		return NewScanner("", p.opts...)
+	}
+	return p
+}
+
+func (p *Parser) get(text string) *Scanner {
+	scan := p.pool.Get().(*Scanner)
+	scan.Reset(text)
+	return scan
+}
+
+func (p *Parser) put(scan *Scanner) {
+	scan.Reset("")
+	p.pool.Put(scan)
+}
+
+// Parse parses text and returns its tree. The error is a *SyntaxError if
+// the grammar does not accept text, or the error reported by Scanner.Err
+// if a limit stopped the parse.
+func (p *Parser) Parse(text string) (*Tree, error) {
+	scan := p.get(text)
+	defer p.put(scan)
+	t, ok := p.expr.Parse(scan)
+	if err := result(scan, ok); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Match recognizes text without building a tree. It returns the same
+// errors as Parse.
+func (p *Parser) Match(text string) error {
+	scan := p.get(text)
+	defer p.put(scan)
+	return result(scan, scan.match(p.expr))
+}
+
+// ParseAll parses texts in parallel, using up to GOMAXPROCS goroutines,
+// and returns their results in the same order.
+func (p *Parser) ParseAll(texts []string) []Result {
+	results := make([]Result, len(texts))
+	workers := min(runtime.GOMAXPROCS(0), len(texts))
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1)) - 1
+				if i >= len(texts) {
+					return
+				}
+				t, err := p.Parse(texts[i])
+				results[i] = Result{t, err}
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func result(scan *Scanner, ok bool) error {
+	if err := scan.Err(); err != nil {
+		return err
+	}
+	if !ok {
+		return &SyntaxError{Pos: scan.LPos}
+	}
+	return nil
+}
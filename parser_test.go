@@ -0,0 +1,85 @@
+package peg
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestScannerReset(t *testing.T) {
+	g := NewSequence(newIPv4PrefixGrammar(), EOT)
+	for _, opts := range [][]ScannerOption{nil, {WithMapMemo()}, {WithMemoCapacity(4), WithStats()}} {
+		scan := NewScanner("", opts...)
+		for _, text := range []string{"192.168.30.254/24", "10.0.0.1/8", "256.0.0.1/8", ""} {
+			want := NewScanner(text, opts...)
+			wt, wok := g.Parse(want)
+			scan.Reset(text)
+			gt, gok := g.Parse(scan)
+			if gok != wok || scan.Pos != want.Pos || scan.LPos != want.LPos || !sameTree(gt, wt) {
+				t.Errorf("%q: want %v %v %v; but got %v %v %v", text, wok, want.Pos, want.LPos, gok, scan.Pos, scan.LPos)
+			}
+		}
+	}
+}
+
+func TestParser(t *testing.T) {
+	g := NewSequence(newIPv4PrefixGrammar(), EOT)
+	p := NewParser(g)
+	if _, err := p.Parse("192.168.30.254/24"); err != nil {
+		t.Errorf("want accepted; but got %v", err)
+	}
+	var serr *SyntaxError
+	if err := p.Match("192.168.30.254/33"); !errors.As(err, &serr) || serr.Pos != 16 {
+		t.Errorf("want syntax error at 16; but got %v", err)
+	}
+	var lerr *DepthLimitError
+	deep := NewParser(newNestGrammar(), WithMaxDepth(4))
+	if _, err := deep.Parse("((((((x))))))"); !errors.As(err, &lerr) {
+		t.Errorf("want *DepthLimitError; but got %v", err)
+	}
+	if _, err := deep.Parse("(x)"); err != nil {
+		t.Errorf("want the limit error cleared; but got %v", err)
+	}
+}
+
+// TestParserConcurrent is meant to be run with -race.
+func TestParserConcurrent(t *testing.T) {
+	g := NewSequence(newIPv4PrefixGrammar(), EOT)
+	p := NewParser(g)
+	var texts []string
+	for i := 0; i < 300; i++ {
+		texts = append(texts, fmt.Sprintf("%d.%d.%d.%d/%d", i, i%7, i%250, i%13, i%40))
+	}
+	want := make([]Result, len(texts))
+	for i, text := range texts {
+		scan := NewScanner(text)
+		tree, ok := g.Parse(scan)
+		want[i] = Result{tree, result(scan, ok)}
+	}
+	check := func(i int, got Result) {
+		if (got.Err == nil) != (want[i].Err == nil) || (got.Err == nil && !sameTree(got.Tree, want[i].Tree)) {
+			t.Errorf("%q: want %v; but got %v", texts[i], want[i].Err, got.Err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < len(texts); i += 8 {
+				tree, err := p.Parse(texts[i])
+				check(i, Result{tree, err})
+				if err := p.Match(texts[i]); (err == nil) != (want[i].Err == nil) {
+					t.Errorf("%q: want %v; but got %v", texts[i], want[i].Err, err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for i, got := range p.ParseAll(texts) {
+		check(i, got)
+	}
+}
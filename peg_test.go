@@ -1,6 +1,10 @@
 package peg
 
 import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -182,6 +186,261 @@ func TestLongestMatch(t *testing.T) {
 			if matched != tc.matched {
 				t.Errorf("want %q; but got %q", tc.matched, matched)
 			}
+			scan, accepted = Match(tc.g, tc.text)
+			if accepted != tc.accepted {
+				t.Errorf("match: want %v; but got %v", tc.accepted, accepted)
+			}
+			if scan.Longest() != tc.matched {
+				t.Errorf("match: want %q; but got %q", tc.matched, scan.Longest())
+			}
+		})
+	}
+}
+
+func TestScannerLimitsOptional(t *testing.T) {
+	deep := strings.Repeat("(", 1000) + "x" + strings.Repeat(")", 1000)
+	nest := newNestGrammar()
+	// a limit stops the parse even where a failure would be skipped
+	for _, g := range []Expr{NewOptional(nest), NewZeroOrMore(nest)} {
+		scan := NewScanner(deep, WithMaxDepth(100))
+		if _, ok := g.Parse(scan); ok {
+			t.Errorf("%T: want rejected", g)
+		}
+		if _, ok := scan.Err().(*DepthLimitError); !ok {
+			t.Errorf("%T: want *DepthLimitError; but got %v", g, scan.Err())
+		}
+	}
+}
+
+func newNestGrammar() Expr {
+	// nest -> "(" nest ")" / "x"
+	nest := NewRule("nest")
+	nest.Define(NewChoice(
+		NewSequence(NewLiteral("("), nest, NewLiteral(")")),
+		NewLiteral("x"),
+	))
+	return NewSequence(nest, EOT)
+}
+
+func TestScannerLimits(t *testing.T) {
+	deep := strings.Repeat("(", 1000) + "x" + strings.Repeat(")", 1000)
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		text string
+		opts []ScannerOption
+		err  error
+	}{
+		{
+			name: "no limits",
+			text: deep,
+		},
+		{
+			name: "context",
+			text: deep,
+			opts: []ScannerOption{WithContext(canceled)},
+			err:  &CanceledError{},
+		},
+		{
+			name: "steps",
+			text: deep,
+			opts: []ScannerOption{WithMaxSteps(100)},
+			err:  &StepLimitError{},
+		},
+		{
+			name: "depth",
+			text: deep,
+			opts: []ScannerOption{WithMaxDepth(100)},
+			err:  &DepthLimitError{},
+		},
+		{
+			name: "memo",
+			text: deep,
+			opts: []ScannerOption{WithMaxMemo(100)},
+			err:  &MemoLimitError{},
+		},
+		{
+			name: "within limits",
+			text: "((x))",
+			opts: []ScannerOption{WithMaxSteps(100), WithMaxDepth(3), WithMaxMemo(3)},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			scan := NewScanner(tc.text, tc.opts...)
+			_, accepted := newNestGrammar().Parse(scan)
+			err := scan.Err()
+			if tc.err == nil {
+				if err != nil || !accepted {
+					t.Fatalf("want accepted; but got %v, %v", accepted, err)
+				}
+				return
+			}
+			if accepted {
+				t.Fatalf("want rejected")
+			}
+			if reflect.TypeOf(err) != reflect.TypeOf(tc.err) {
+				t.Errorf("want %T; but got %T (%v)", tc.err, err, err)
+			}
+		})
+	}
+}
+
+func TestMemoPolicy(t *testing.T) {
+	text := "3..15|48..279|4094"
+	tests := []struct {
+		name   string
+		opts   []ScannerOption
+		stores int
+		// entries is the number of entries left in the memo table.
+		entries int
+	}{
+		{
+			name:    "default",
+			opts:    []ScannerOption{WithStats()},
+			stores:  9,
+			entries: 9,
+		},
+		{
+			name:    "disabled",
+			opts:    []ScannerOption{WithStats(), WithDefaultMemo(false)},
+			stores:  0,
+			entries: 0,
+		},
+		{
+			name:    "bounded",
+			opts:    []ScannerOption{WithStats(), WithMemoCapacity(2)},
+			stores:  9,
+			entries: 2,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			scan := NewScanner(text, tc.opts...)
+			_, accepted := newRangeGrammar().Parse(scan)
+			if !accepted {
+				t.Fatalf("want accepted")
+			}
+			stats := scan.Stats()
+			if stats.Stores != tc.stores {
+				t.Errorf("want %v stores; but got %v", tc.stores, stats.Stores)
+			}
+			if stats.Rules["number"].Calls != 5 {
+				t.Errorf("want 5 calls; but got %v", stats.Rules["number"].Calls)
+			}
+			if n := stats.Stores - stats.Evictions; n != tc.entries {
+				t.Errorf("want %v entries; but got %v", tc.entries, n)
+			}
 		})
 	}
+
+	number := NewRule("number")
+	number.Define(NewOneOrMore(NewCharclass(RuneRange{'0', '9'})))
+	number.NoMemo()
+	scan := NewScanner("42", WithStats())
+	number.Parse(scan)
+	if _, ok := scan.Memo(0, "number"); ok {
+		t.Errorf("want no memo for NoMemo rule")
+	}
+	number.Memo()
+	scan = NewScanner("42", WithStats(), WithDefaultMemo(false))
+	number.Parse(scan)
+	if _, ok := scan.Memo(0, "number"); !ok {
+		t.Errorf("want memo for Memo rule")
+	}
+}
+
+// sameTree compares the spans, indexes and tags of two trees.
+func sameTree(a, b *Tree) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Start != b.Start || a.End != b.End || a.Index != b.Index {
+		return false
+	}
+	atags, btags := a.TagNames(), b.TagNames()
+	if len(atags) != len(btags) {
+		return false
+	}
+	for _, name := range atags {
+		if !b.HasTag(name) {
+			return false
+		}
+	}
+	if len(a.Child) != len(b.Child) {
+		return false
+	}
+	for i := range a.Child {
+		if !sameTree(a.Child[i], b.Child[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestArena(t *testing.T) {
+	texts := []string{
+		"3..15|48..279|4094",
+		"3..15|48..",
+	}
+	arena := NewArena()
+	for _, text := range texts {
+		want, wantok := newRangeGrammar().Parse(NewScanner(text))
+		arena.Reset()
+		got, gotok := newRangeGrammar().Parse(NewScanner(text, WithArena(arena)))
+		if gotok != wantok {
+			t.Errorf("want %v; but got %v", wantok, gotok)
+		}
+		if wantok && !sameTree(want, got) {
+			t.Errorf("trees differ for %q", text)
+		}
+		if wantok && got.Child[0].Tags != nil {
+			t.Errorf("want no Tags map")
+		}
+		if wantok && !got.Child[0].HasTag("rule:expr") {
+			t.Errorf("want rule tag")
+		}
+		if wantok && cap(got.Child) != len(got.Child) {
+			t.Errorf("want child list capped at its length")
+		}
+	}
+}
+
+func TestRuleNumbers(t *testing.T) {
+	// the memo table of a grammar does not grow with the rules of the
+	// grammars loaded before it
+	for i := 0; i < 1000; i++ {
+		g, err := LoadGrammar(fmt.Sprintf("number%v <- digits%v EOT\ndigits%v <- [0-9]+", i, i, i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		scan := NewScanner("123")
+		if _, ok := g.Parse(scan); !ok {
+			t.Fatal("not accepted")
+		}
+		if n := len(scan.memo.(*denseMemo).cols); n > 2 {
+			t.Fatalf("grammar %v: want at most 2 columns; but got %v", i, n)
+		}
+	}
+
+	// a rule numbered with another grammar gets a column of its own
+	shared := NewRule("shared")
+	shared.Define(NewLiteral("a"))
+	shared.Parse(NewScanner("a"))
+	first := NewRule("first")
+	first.Define(NewSequence(shared, NewLiteral("b")))
+	scan := NewScanner("ab")
+	if _, ok := first.Parse(scan); !ok {
+		t.Fatal("not accepted")
+	}
+	for _, name := range []string{"first", "shared"} {
+		if _, ok := scan.Memo(0, name); !ok {
+			t.Errorf("%v: not memoized", name)
+		}
+	}
+	if _, ok := scan.Memo(0, "no such rule"); ok {
+		t.Errorf("found a missing memo")
+	}
 }
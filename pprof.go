@@ -0,0 +1,134 @@
+package peg
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// WriteProfile writes the measures as a gzipped profile.proto, the format
+// of runtime/pprof, where rules are the functions of the call stacks. Each
+// stack has the number of calls and the self time of its innermost rule,
+// so that go tool pprof shows the time of each rule and of its callees.
+func (p *Profiler) WriteProfile(w io.Writer) error {
+	var b protoBuffer
+	strs := map[string]int{"": 0}
+	table := []string{""}
+	str := func(s string) uint64 {
+		i, ok := strs[s]
+		if !ok {
+			i = len(table)
+			strs[s] = i
+			table = append(table, s)
+		}
+		return uint64(i)
+	}
+	valueType := func(typ, unit string) []byte {
+		var v protoBuffer
+		v.uint(1, str(typ))
+		v.uint(2, str(unit))
+		return v.bytes
+	}
+
+	// Profile.sample_type
+	b.message(1, valueType("calls", "count"))
+	b.message(1, valueType("time", "nanoseconds"))
+
+	// every rule is a function at a location of the same id
+	ids := make(map[string]uint64)
+	var names []string
+	for _, key := range p.order {
+		for _, name := range p.samples[key].stack {
+			if _, ok := ids[name]; !ok {
+				ids[name] = uint64(len(names) + 1)
+				names = append(names, name)
+			}
+		}
+	}
+
+	// Profile.sample
+	for _, key := range p.order {
+		s := p.samples[key]
+		var sample protoBuffer
+		locs := make([]uint64, len(s.stack))
+		for i, name := range s.stack {
+			// the innermost frame comes first
+			locs[len(s.stack)-1-i] = ids[name]
+		}
+		sample.packed(1, locs)
+		sample.packed(2, []uint64{uint64(s.calls), uint64(s.self.Nanoseconds())})
+		b.message(2, sample.bytes)
+	}
+
+	// Profile.location
+	for i := range names {
+		id := uint64(i + 1)
+		var line protoBuffer
+		line.uint(1, id)
+		var loc protoBuffer
+		loc.uint(1, id)
+		loc.message(4, line.bytes)
+		b.message(4, loc.bytes)
+	}
+
+	// Profile.function
+	for i, name := range names {
+		var fn protoBuffer
+		fn.uint(1, uint64(i+1))
+		fn.uint(2, str(name))
+		fn.uint(3, str(name))
+		b.message(5, fn.bytes)
+	}
+
+	// Profile.duration_nanos, period_type and period
+	b.uint(10, uint64(p.Duration.Nanoseconds()))
+	b.message(11, valueType("time", "nanoseconds"))
+	b.uint(12, 1)
+
+	// Profile.string_table is written last, once every string is known
+	for _, s := range table {
+		b.message(6, []byte(s))
+	}
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(b.bytes); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// protoBuffer encodes the protocol buffer fields used by profile.proto.
+type protoBuffer struct {
+	bytes []byte
+}
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.bytes = append(b.bytes, byte(x)|0x80)
+		x >>= 7
+	}
+	b.bytes = append(b.bytes, byte(x))
+}
+
+// uint writes a varint field. Zero values are left out as in proto3.
+func (b *protoBuffer) uint(field int, x uint64) {
+	if x == 0 {
+		return
+	}
+	b.varint(uint64(field) << 3)
+	b.varint(x)
+}
+
+// message writes a length-delimited field: a message, a string or bytes.
+func (b *protoBuffer) message(field int, data []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(data)))
+	b.bytes = append(b.bytes, data...)
+}
+
+func (b *protoBuffer) packed(field int, xs []uint64) {
+	var p protoBuffer
+	for _, x := range xs {
+		p.varint(x)
+	}
+	b.message(field, p.bytes)
+}
@@ -0,0 +1,156 @@
+package peg
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+var _ Tracer = &Profiler{}
+
+// Profiler is a Tracer that measures the rules of the parses it is attached
+// to with WithTracer. It adds up over several parses.
+type Profiler struct {
+	Rules map[string]*RuleProfile
+	// Duration is the time spent in the outermost rules.
+	Duration time.Duration
+
+	stack   []profFrame
+	active  map[string]int
+	samples map[string]*profSample
+	// order lists the keys of samples as they were first seen.
+	order []string
+	now   func() time.Time
+}
+
+// RuleProfile holds the measures of a single rule. Time includes the rules
+// it calls, Self does not. Time of recursive calls is counted once.
+type RuleProfile struct {
+	Calls       int
+	Hits        int
+	Failures    int
+	Consumed    int
+	Backtracked int
+	Time        time.Duration
+	Self        time.Duration
+}
+
+type profFrame struct {
+	name     string
+	start    time.Time
+	children time.Duration
+}
+
+// profSample is the number of calls and the self time of a call stack.
+type profSample struct {
+	stack []string
+	calls int64
+	self  time.Duration
+}
+
+func NewProfiler() *Profiler {
+	p := new(Profiler)
+	p.Rules = make(map[string]*RuleProfile)
+	p.active = make(map[string]int)
+	p.samples = make(map[string]*profSample)
+	p.now = time.Now
+	return p
+}
+
+func (p *Profiler) rule(name string) *RuleProfile {
+	r, ok := p.Rules[name]
+	if !ok {
+		r = new(RuleProfile)
+		p.Rules[name] = r
+	}
+	return r
+}
+
+func (p *Profiler) Enter(ev TraceEvent) {
+	if ev.Rule == nil {
+		return
+	}
+	p.active[ev.Name]++
+	p.stack = append(p.stack, profFrame{name: ev.Name, start: p.now()})
+}
+
+func (p *Profiler) Exit(ev TraceEvent) {
+	if ev.Rule == nil {
+		return
+	}
+	n := len(p.stack) - 1
+	f := p.stack[n]
+	elapsed := p.now().Sub(f.start)
+	self := elapsed - f.children
+
+	r := p.rule(ev.Name)
+	r.Calls++
+	if ev.Memo == MemoHit {
+		r.Hits++
+	}
+	if ev.OK {
+		r.Consumed += ev.End - ev.Pos
+	} else {
+		r.Failures++
+		r.Backtracked += ev.Backtrack
+	}
+	r.Self += self
+	p.active[ev.Name]--
+	if p.active[ev.Name] == 0 {
+		r.Time += elapsed
+	}
+
+	// stacks are keyed by their rule names from the outermost
+	names := make([]string, len(p.stack))
+	for i := range p.stack {
+		names[i] = p.stack[i].name
+	}
+	key := strings.Join(names, "\x00")
+	s, ok := p.samples[key]
+	if !ok {
+		s = &profSample{stack: names}
+		p.samples[key] = s
+		p.order = append(p.order, key)
+	}
+	s.calls++
+	s.self += self
+
+	p.stack = p.stack[:n]
+	if n > 0 {
+		p.stack[n-1].children += elapsed
+	} else {
+		p.Duration += elapsed
+	}
+}
+
+// Write prints a table of the rule measures sorted by time.
+func (p *Profiler) Write(w io.Writer) error {
+	names := make([]string, 0, len(p.Rules))
+	for name := range p.Rules {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := p.Rules[names[i]], p.Rules[names[j]]
+		if a.Time != b.Time {
+			return a.Time > b.Time
+		}
+		return names[i] < names[j]
+	})
+	_, err := fmt.Fprintf(w, "%-20s %10s %10s %10s %10s %10s %12s %12s\n",
+		"rule", "calls", "hits", "failures", "consumed", "backtrack", "self", "time")
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		r := p.Rules[name]
+		_, err := fmt.Fprintf(w, "%-20s %10d %10d %10d %10d %10d %12v %12v\n",
+			name, r.Calls, r.Hits, r.Failures, r.Consumed, r.Backtracked, r.Self, r.Time)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "total %v\n", p.Duration)
+	return err
+}
@@ -0,0 +1,75 @@
+package peg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProfiler(t *testing.T) {
+	g := newTracePairGrammar()
+	p := NewProfiler()
+	// every reading of the clock takes a millisecond
+	var clock time.Time
+	p.now = func() time.Time {
+		clock = clock.Add(time.Millisecond)
+		return clock
+	}
+	g.Parse(NewScanner("12.3", WithTracer(p)))
+	g.Parse(NewScanner("1.x", WithTracer(p)))
+
+	want := map[string]RuleProfile{
+		"tracePair": {Calls: 2, Failures: 1, Consumed: 4, Backtracked: 2, Time: 14 * time.Millisecond, Self: 8 * time.Millisecond},
+		"traceNum":  {Calls: 6, Hits: 2, Failures: 1, Consumed: 7, Time: 6 * time.Millisecond, Self: 6 * time.Millisecond},
+	}
+	for name, w := range want {
+		if got := p.Rules[name]; got == nil || *got != w {
+			t.Errorf("%v: want %+v; but got %+v", name, w, got)
+		}
+	}
+	if p.Duration != 14*time.Millisecond {
+		t.Errorf("want duration 14ms; but got %v", p.Duration)
+	}
+
+	var sb strings.Builder
+	if err := p.Write(&sb); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(sb.String(), "\n")
+	if !strings.HasPrefix(lines[1], "tracePair ") || !strings.HasPrefix(lines[2], "traceNum ") {
+		t.Errorf("rules are not sorted by time:\n%s", sb.String())
+	}
+
+	var buf bytes.Buffer
+	if err := p.WriteProfile(&buf); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"tracePair", "traceNum", "calls", "nanoseconds"} {
+		if !bytes.Contains(data, []byte(s)) {
+			t.Errorf("profile has no string %q", s)
+		}
+	}
+}
+
+func TestProtoBuffer(t *testing.T) {
+	var b protoBuffer
+	b.uint(1, 150)
+	b.uint(2, 0)
+	b.message(3, []byte("ab"))
+	b.packed(4, []uint64{1, 300})
+	want := []byte{0x08, 0x96, 0x01, 0x1a, 0x02, 'a', 'b', 0x22, 0x03, 0x01, 0xac, 0x02}
+	if !bytes.Equal(b.bytes, want) {
+		t.Errorf("want % x; but got % x", want, b.bytes)
+	}
+}
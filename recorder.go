@@ -0,0 +1,56 @@
+package peg
+
+var _ Tracer = &Recorder{}
+
+// Recorder is a Tracer that records the outcome of the rule calls of a
+// parse by position, for the memo table of a Report.
+type Recorder struct {
+	calls map[recordKey]*recordedCalls
+}
+
+type recordKey struct {
+	pos  int
+	name string
+}
+
+// recordedCalls sums up the calls of a rule at a position. end is where
+// the last successful call ended, and lpos is the longest match of all.
+type recordedCalls struct {
+	calls    int
+	hits     int
+	failures int
+	end      int
+	lpos     int
+}
+
+func NewRecorder() *Recorder {
+	r := new(Recorder)
+	r.calls = make(map[recordKey]*recordedCalls)
+	return r
+}
+
+func (r *Recorder) Enter(ev TraceEvent) {
+}
+
+func (r *Recorder) Exit(ev TraceEvent) {
+	if ev.Rule == nil {
+		return
+	}
+	k := recordKey{ev.Pos, ev.Name}
+	c, ok := r.calls[k]
+	if !ok {
+		c = &recordedCalls{end: -1, lpos: ev.Pos}
+		r.calls[k] = c
+	}
+	c.calls++
+	if ev.Memo == MemoHit {
+		c.hits++
+	}
+	if ev.OK {
+		c.end = ev.End
+		c.lpos = max(c.lpos, ev.End)
+	} else {
+		c.failures++
+		c.lpos = max(c.lpos, ev.Pos+ev.Backtrack)
+	}
+}
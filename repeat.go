@@ -26,10 +26,13 @@ func NewRepeat(expr Expr, limit *Limit) *Repeat {
 }
 
 func (r *Repeat) Parse(scan *Scanner) (*Tree, bool) {
-	t := NewTree(scan.Pos)
-	for !r.limit.Over(len(t.Child)) {
+	t := scan.newTree(scan.Pos)
+	// children are collected on the scanner stack and then copied into a
+	// list of the right size.
+	base := len(scan.stack)
+	for !r.limit.Over(len(scan.stack) - base) {
 		pos := scan.Pos
-		child, ok := r.expr.Parse(scan)
+		child, ok := scan.parse(r.expr)
 		if !ok {
 			scan.Pos = pos
 			break
@@ -37,10 +40,32 @@ func (r *Repeat) Parse(scan *Scanner) (*Tree, bool) {
 		if scan.Pos == pos {
 			break
 		}
+		scan.stack = append(scan.stack, child)
+	}
+	t.Child = scan.children(len(scan.stack) - base)
+	for _, child := range scan.stack[base:] {
 		t.Append(child)
 	}
-	if r.limit.Under(len(t.Child)) {
+	clear(scan.stack[base:])
+	scan.stack = scan.stack[:base]
+	if scan.err != nil || r.limit.Under(len(t.Child)) {
 		return t, false
 	}
 	return t, true
 }
+
+func (r *Repeat) Match(scan *Scanner) bool {
+	n := 0
+	for !r.limit.Over(n) {
+		pos := scan.Pos
+		if !scan.match(r.expr) {
+			scan.Pos = pos
+			break
+		}
+		if scan.Pos == pos {
+			break
+		}
+		n++
+	}
+	return scan.err == nil && !r.limit.Under(n)
+}
@@ -0,0 +1,301 @@
+package peg
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Report describes a parse as a self-contained HTML page: the input, the
+// tree with the span of each node highlighted on hover, the memo table as
+// a grid of rules by positions, and the furthest failure.
+type Report struct {
+	Title string
+	// Expr is the grammar. If set, the furthest failure is explained as
+	// by Diagnose.
+	Expr Expr
+	Scan *Scanner
+	// Tree is the result of the parse, or nil.
+	Tree *Tree
+	// Recorder, if it was attached to the parse with WithTracer, adds the
+	// failed calls and the memo hits to the grid.
+	Recorder *Recorder
+}
+
+type reportPage struct {
+	Title    string
+	Accepted bool
+	Len      int
+	LPos     int
+	Failure  string
+	Chars    []reportChar
+	Tree     *reportNode
+	Columns  []reportChar
+	Rows     []reportRow
+}
+
+// reportChar is a character of the input, or the end of the input if Text
+// is empty.
+type reportChar struct {
+	Pos  int
+	Text string
+	Fail bool
+}
+
+type reportNode struct {
+	Label    string
+	Start    int
+	End      int
+	Text     string
+	Children []*reportNode
+}
+
+type reportRow struct {
+	Rule     string
+	Cells    []reportCell
+	Furthest int
+}
+
+type reportCell struct {
+	Class string
+	Text  string
+	Title string
+	Start int
+	End   int
+}
+
+// reportEntry is what is known of a rule at a position.
+type reportEntry struct {
+	recordedCalls
+	memo  bool
+	reach int
+}
+
+// WriteHTML writes the report as an HTML page.
+func (r *Report) WriteHTML(w io.Writer) error {
+	scan := r.Scan
+	page := &reportPage{
+		Title:    r.Title,
+		Accepted: r.Tree != nil,
+		Len:      len(scan.Text),
+		LPos:     scan.LPos,
+	}
+	if page.Title == "" {
+		page.Title = "Parse report"
+	}
+	// the longest match stops short of the input when the parse failed or
+	// left input over
+	failed := r.Tree == nil || r.Tree.End < len(scan.Text)
+	if failed && r.Expr != nil {
+		page.Failure = Diagnose(r.Expr, scan, "").Error()
+	}
+	for pos, ch := range scan.Text {
+		c := reportChar{Pos: pos, Text: string(ch), Fail: failed && pos == scan.LPos}
+		page.Chars = append(page.Chars, c)
+		page.Columns = append(page.Columns, c)
+	}
+	end := reportChar{Pos: len(scan.Text), Fail: failed && scan.LPos == len(scan.Text)}
+	page.Chars = append(page.Chars, end)
+	page.Columns = append(page.Columns, end)
+	if r.Tree != nil {
+		page.Tree = reportTree(scan.Text, r.Tree)
+	}
+	page.Rows = r.rows(page.Columns)
+	return reportTemplate.Execute(w, page)
+}
+
+func reportTree(text string, t *Tree) *reportNode {
+	var names []string
+	for _, name := range t.TagNames() {
+		names = append(names, strings.TrimPrefix(name, "rule:"))
+	}
+	sort.Strings(names)
+	n := &reportNode{
+		Label: strings.Join(names, ", "),
+		Start: t.Start,
+		End:   t.End,
+		Text:  reportSnippet(text[t.Start:t.End]),
+	}
+	for _, c := range t.Child {
+		if c != nil {
+			n.Children = append(n.Children, reportTree(text, c))
+		}
+	}
+	return n
+}
+
+// reportSnippet quotes s, shortened to a few dozen characters.
+func reportSnippet(s string) string {
+	const limit = 40
+	if utf8.RuneCountInString(s) <= limit {
+		return fmt.Sprintf("%q", s)
+	}
+	i := 0
+	for n := 0; n < limit; n++ {
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+	}
+	return fmt.Sprintf("%q…", s[:i])
+}
+
+// rows merges the memo table and the recorded calls into a row per rule,
+// in the order of their first position.
+func (r *Report) rows(columns []reportChar) []reportRow {
+	entries := make(map[recordKey]*reportEntry)
+	entry := func(k recordKey) *reportEntry {
+		e, ok := entries[k]
+		if !ok {
+			e = &reportEntry{recordedCalls: recordedCalls{end: -1, lpos: k.pos}, reach: -1}
+			entries[k] = e
+		}
+		return e
+	}
+	r.Scan.EachMemo(func(pos int, name string, m Memo) {
+		e := entry(recordKey{pos, name})
+		e.memo = true
+		e.end = m.Pos
+		e.lpos = max(e.lpos, m.lpos)
+		e.reach = m.Reach
+	})
+	if r.Recorder != nil {
+		for k, c := range r.Recorder.calls {
+			e := entry(k)
+			end, lpos := e.end, e.lpos
+			e.recordedCalls = *c
+			e.end = max(e.end, end)
+			e.lpos = max(e.lpos, lpos)
+		}
+	}
+
+	first := make(map[string]int)
+	for k := range entries {
+		if pos, ok := first[k.name]; !ok || k.pos < pos {
+			first[k.name] = k.pos
+		}
+	}
+	names := make([]string, 0, len(first))
+	for name := range first {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := first[names[i]], first[names[j]]
+		if a != b {
+			return a < b
+		}
+		return names[i] < names[j]
+	})
+
+	rows := make([]reportRow, len(names))
+	for i, name := range names {
+		row := reportRow{Rule: name, Furthest: -1}
+		for _, col := range columns {
+			e, ok := entries[recordKey{col.Pos, name}]
+			if !ok {
+				row.Cells = append(row.Cells, reportCell{Start: col.Pos, End: col.Pos})
+				continue
+			}
+			row.Cells = append(row.Cells, e.cell(name, col.Pos))
+			row.Furthest = max(row.Furthest, e.lpos, e.reach)
+		}
+		rows[i] = row
+	}
+	return rows
+}
+
+func (e *reportEntry) cell(name string, pos int) reportCell {
+	c := reportCell{Start: pos, End: pos}
+	var notes []string
+	if e.end >= 0 {
+		c.Class = "ok"
+		c.Text = fmt.Sprintf("+%d", e.end-pos)
+		c.End = e.end
+		notes = append(notes, fmt.Sprintf("%s @%d matched %d-%d", name, pos, pos, e.end))
+	} else {
+		c.Class = "fail"
+		c.Text = "✗"
+		c.End = e.lpos
+		notes = append(notes, fmt.Sprintf("%s @%d failed", name, pos))
+	}
+	if e.calls > 0 {
+		notes = append(notes, fmt.Sprintf("%d calls, %d memo hits, %d failures", e.calls, e.hits, e.failures))
+	}
+	if e.hits > 0 {
+		c.Class += " hit"
+	}
+	notes = append(notes, fmt.Sprintf("longest match to %d", e.lpos))
+	if e.reach >= 0 {
+		notes = append(notes, fmt.Sprintf("examined to %d", e.reach))
+	}
+	if !e.memo {
+		notes = append(notes, "not in the memo table")
+	}
+	c.Title = strings.Join(notes, "\n")
+	return c
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+pre, .grid td, .grid th, summary { font-family: monospace; }
+#text { white-space: pre-wrap; border: 1px solid #ccc; padding: 0.5em; }
+#text span.end { color: #999; }
+.hl { background: #ffe08a; }
+.failpos { outline: 2px solid #d33; }
+.tree details { margin-left: 1.2em; }
+.tree summary { cursor: default; }
+.tree .span { color: #666; }
+.grid { border-collapse: collapse; font-size: 12px; }
+.grid th, .grid td { border: 1px solid #ddd; padding: 1px 3px; text-align: center; }
+.grid th.rule { text-align: left; }
+.grid td.ok { background: #c8f0c8; }
+.grid td.fail { background: #f6c6c6; }
+.grid td.hit { font-weight: bold; }
+.accepted { color: #080; }
+.rejected { color: #d33; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{if .Accepted}}<span class="accepted">accepted</span>{{else}}<span class="rejected">rejected</span>{{end}},
+{{.Len}} bytes, longest match {{.LPos}}</p>
+{{with .Failure}}<p class="rejected">{{.}}</p>{{end}}
+
+<h2>Input</h2>
+<div id="text">{{range .Chars}}<span data-i="{{.Pos}}"{{if .Fail}} class="failpos"{{end}}>{{if .Text}}{{.Text}}{{else}}<span class="end">⏚</span>{{end}}</span>{{end}}</div>
+
+<h2>Tree</h2>
+<div class="tree">{{with .Tree}}{{template "node" .}}{{else}}<p>no tree</p>{{end}}</div>
+
+<h2>Memo table</h2>
+<p>Green cells are matches with their length, red cells failures, bold cells memo hits. Hover a cell for details.</p>
+<table class="grid">
+<tr><th class="rule">rule</th>{{range .Columns}}<th{{if .Fail}} class="failpos"{{end}} title="{{.Pos}}">{{if .Text}}{{printf "%q" .Text}}{{else}}end{{end}}</th>{{end}}<th>furthest</th></tr>
+{{range .Rows}}<tr><th class="rule">{{.Rule}}</th>{{range .Cells}}<td{{with .Class}} class="{{.}}"{{end}}{{with .Title}} title="{{.}}"{{end}} data-s="{{.Start}}" data-e="{{.End}}">{{.Text}}</td>{{end}}<td>{{.Furthest}}</td></tr>
+{{end}}</table>
+
+<script>
+const chars = Array.from(document.querySelectorAll("#text span[data-i]"));
+function mark(s, e, on) {
+	for (const c of chars) {
+		const i = +c.dataset.i;
+		if (i >= s && i < Math.max(e, s+1)) {
+			c.classList.toggle("hl", on);
+		}
+	}
+}
+for (const n of document.querySelectorAll("[data-s]")) {
+	n.addEventListener("mouseover", ev => { ev.stopPropagation(); mark(+n.dataset.s, +n.dataset.e, true); });
+	n.addEventListener("mouseout", ev => { ev.stopPropagation(); mark(+n.dataset.s, +n.dataset.e, false); });
+}
+</script>
+</body>
+</html>
+{{define "node"}}<details open><summary data-s="{{.Start}}" data-e="{{.End}}">{{if .Label}}{{.Label}}{{else}}·{{end}} <span class="span">{{.Start}}-{{.End}} {{.Text}}</span></summary>{{range .Children}}{{template "node" .}}{{end}}</details>{{end}}
+`))
@@ -0,0 +1,51 @@
+package peg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReport(t *testing.T) {
+	g := newTracePairGrammar()
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{
+			text: "12.3",
+			want: []string{
+				`<span class="accepted">accepted</span>`,
+				`<summary data-s="0" data-e="4">tracePair <span class="span">0-4 &#34;12.3&#34;</span></summary>`,
+				`<th class="rule">traceNum</th><td class="ok hit" title="traceNum @0 matched 0-2` + "\n" + `2 calls, 1 memo hits, 0 failures` + "\n" + `longest match to 2` + "\n" + `examined to 3" data-s="0" data-e="2">&#43;2</td>`,
+			},
+		},
+		{
+			text: "1.<x",
+			want: []string{
+				`<span class="rejected">rejected</span>`,
+				`<p class="rejected">1:3: expected [&#39;0&#39;-&#39;9&#39;], found &#39;&lt;&#39;</p>`,
+				`<span data-i="2" class="failpos">&lt;</span>`,
+				`<td class="fail" title="traceNum @2 failed` + "\n" + `1 calls, 0 memo hits, 1 failures` + "\n" + `longest match to 2` + "\n" + `not in the memo table" data-s="2" data-e="2">✗</td>`,
+				`<p>no tree</p>`,
+			},
+		},
+	}
+	for _, tc := range tests {
+		rec := NewRecorder()
+		scan := NewScanner(tc.text, WithTracer(rec))
+		tree, ok := g.Parse(scan)
+		if !ok {
+			tree = nil
+		}
+		r := &Report{Expr: g, Scan: scan, Tree: tree, Recorder: rec}
+		var sb strings.Builder
+		if err := r.WriteHTML(&sb); err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(sb.String(), want) {
+				t.Errorf("%q: want %q in\n%s", tc.text, want, sb.String())
+			}
+		}
+	}
+}
@@ -1,34 +1,203 @@
 package peg
 
+import (
+	"sync"
+	"sync/atomic"
+)
+
 var _ Expr = &Rule{}
 
+type memoPolicy int
+
+const (
+	memoDefault memoPolicy = iota
+	memoOn
+	memoOff
+)
+
 type Rule struct {
 	name string
-	expr Expr
+	// id is the number of the rule within its grammar, valid once
+	// numbered is set.
+	id       int
+	numbered atomic.Bool
+	tag      string
+	expr     Expr
+	policy   memoPolicy
+	// display is the label used in error messages, if set.
+	display string
+	// hidden leaves the rule out of error messages where it starts.
+	hidden bool
 }
 
 func NewRule(name string) *Rule {
 	r := new(Rule)
 	r.name = name
+	r.tag = "rule:" + name
 	return r
 }
 
+// numbering serializes number.
+var numbering sync.Mutex
+
+// number numbers the rules reachable from e that have no number yet from
+// 0, so that the memo table of a parse has as many columns as its grammar
+// has rules. Grammars are numbered when they are built or optimized, and
+// other rules when they are first parsed. Rules that are shared by several
+// grammars keep their first number; scanners tell them apart by name.
+func number(e Expr) {
+	numberRules(rules(e))
+}
+
+// numberRules numbers the rules of list that have no number yet.
+func numberRules(list []*Rule) {
+	numbering.Lock()
+	defer numbering.Unlock()
+	n := 0
+	for _, r := range list {
+		if !r.numbered.Load() {
+			r.id = n
+			n++
+			r.numbered.Store(true)
+		}
+	}
+}
+
 func (r *Rule) Define(expr Expr) {
 	r.expr = expr
 }
 
+// copy returns a new rule with the name and settings of r and no
+// definition.
+func (r *Rule) copy() *Rule {
+	c := NewRule(r.name)
+	c.policy = r.policy
+	c.display = r.display
+	c.hidden = r.hidden
+	return c
+}
+
+// SetDisplayName sets a human-readable label that error messages and
+// completion report instead of the contents of the rule when it fails
+// where it starts.
+func (r *Rule) SetDisplayName(label string) {
+	r.display = label
+}
+
+// DisplayName returns the label set by SetDisplayName, or the name of the
+// rule.
+func (r *Rule) DisplayName() string {
+	if r.display != "" {
+		return r.display
+	}
+	return r.name
+}
+
+// Hide leaves the rule out of error messages and completion where it
+// starts: what it tries there is not reported as expected. It suits
+// whitespace and comments, which may come almost anywhere. What it tries
+// after its start, such as the end of an unclosed comment, is still
+// reported.
+func (r *Rule) Hide() {
+	r.hidden = true
+}
+
+// Memo makes the rule memoized even if the scanner disables memoization
+// by default.
+func (r *Rule) Memo() {
+	r.policy = memoOn
+}
+
+// NoMemo excludes the rule from memoization. It suits token-level rules
+// that are cheaper to reparse than to look up.
+func (r *Rule) NoMemo() {
+	r.policy = memoOff
+}
+
 func (r *Rule) Parse(scan *Scanner) (*Tree, bool) {
+	if scan.tracer != nil {
+		return scan.traceParse(r, r, r.parse)
+	}
+	return r.parse(scan)
+}
+
+func (r *Rule) parse(scan *Scanner) (*Tree, bool) {
 	pos := scan.Pos
-	memo, ok := scan.Memo(pos, r.name)
-	if ok {
-		scan.Pos = memo.Pos
-		return memo.Tree, true
+	memoize := scan.memoize(r)
+	if scan.stats != nil {
+		scan.stats.rule(r.name).Calls++
+	}
+	if memoize {
+		memo, ok := scan.recall(r, pos, true)
+		if ok {
+			scan.Pos = memo.Pos
+			scan.examine(memo.Reach)
+			scan.LPos = max(scan.LPos, memo.lpos)
+			return scan.reuse(memo.Tree), true
+		}
 	}
-	t, ok := r.expr.Parse(scan)
+	if !scan.enterRule(r, pos) {
+		return nil, false
+	}
+	// the rule records how far its own definition looked and matched
+	reach, lpos := scan.reach, scan.LPos
+	scan.reach, scan.LPos = pos, pos
+	t, ok := scan.parse(r.expr)
+	scan.leaveRule()
+	examined, longest := scan.reach, scan.LPos
+	scan.reach, scan.LPos = max(reach, examined), max(lpos, longest)
 	if !ok {
 		return t, false
 	}
-	t.SetTag("rule:" + r.name)
-	scan.SetMemo(pos, r.name, Memo{scan.Pos, t})
+	if t == nil {
+		t = scan.newTree(pos)
+	}
+	t.SetTag(r.tag)
+	if memoize {
+		scan.store(r, pos, Memo{Pos: scan.Pos, Tree: t, Reach: examined, lpos: longest})
+		t = scan.reuse(t)
+	}
 	return t, true
 }
+
+// Match recognizes the rule without building a tree. Its memo entries have
+// no tree and are ignored by Parse.
+func (r *Rule) Match(scan *Scanner) bool {
+	if scan.tracer != nil {
+		return scan.traceMatch(r, r, r.match)
+	}
+	return r.match(scan)
+}
+
+func (r *Rule) match(scan *Scanner) bool {
+	pos := scan.Pos
+	memoize := scan.memoize(r)
+	if scan.stats != nil {
+		scan.stats.rule(r.name).Calls++
+	}
+	if memoize {
+		memo, ok := scan.recall(r, pos, false)
+		if ok {
+			scan.Pos = memo.Pos
+			scan.examine(memo.Reach)
+			scan.LPos = max(scan.LPos, memo.lpos)
+			return true
+		}
+	}
+	if !scan.enterRule(r, pos) {
+		return false
+	}
+	reach, lpos := scan.reach, scan.LPos
+	scan.reach, scan.LPos = pos, pos
+	ok := scan.match(r.expr)
+	scan.leaveRule()
+	examined, longest := scan.reach, scan.LPos
+	scan.reach, scan.LPos = max(reach, examined), max(lpos, longest)
+	if !ok {
+		return false
+	}
+	if memoize {
+		scan.store(r, pos, Memo{Pos: scan.Pos, Reach: examined, lpos: longest})
+	}
+	return true
+}
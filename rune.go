@@ -1,5 +1,9 @@
 package peg
 
+import (
+	"unicode"
+)
+
 type RuneSubset interface {
 	Within(rune) bool
 }
@@ -49,3 +53,12 @@ func (u RuneUnion) Within(x rune) bool {
 	}
 	return false
 }
+
+// RuneTable is a Unicode category or script, such as unicode.Letter.
+type RuneTable struct {
+	T *unicode.RangeTable
+}
+
+func (t RuneTable) Within(x rune) bool {
+	return unicode.Is(t.T, x)
+}
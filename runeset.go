@@ -0,0 +1,185 @@
+package peg
+
+import (
+	"sort"
+	"unicode/utf8"
+)
+
+// runeSet is a sorted list of disjoint, non-adjacent closed intervals.
+type runeSet []runeInterval
+
+type runeInterval struct {
+	lo rune
+	hi rune
+}
+
+var fullRuneSet = runeSet{{0, utf8.MaxRune}}
+
+// newRuneSet converts a RuneSubset into intervals. It reports false for
+// subsets whose contents cannot be enumerated, such as user-defined types.
+func newRuneSet(s RuneSubset) (runeSet, bool) {
+	switch s := s.(type) {
+	case RuneAny:
+		return fullRuneSet, true
+	case RuneValue:
+		return runeSet{{rune(s), rune(s)}}, true
+	case RuneRange:
+		if s[0] > s[1] {
+			return runeSet{}, true
+		}
+		return runeSet{{s[0], s[1]}}, true
+	case RuneInvert:
+		x, ok := newRuneSet(s.S)
+		if !ok {
+			return nil, false
+		}
+		return x.invert(), true
+	case RuneUnion:
+		var u runeSet
+		for _, e := range s {
+			x, ok := newRuneSet(e)
+			if !ok {
+				return nil, false
+			}
+			u = u.union(x)
+		}
+		return u, true
+	case RuneTable:
+		var u runeSet
+		for _, r := range s.T.R16 {
+			u = appendStride(u, rune(r.Lo), rune(r.Hi), rune(r.Stride))
+		}
+		for _, r := range s.T.R32 {
+			u = appendStride(u, rune(r.Lo), rune(r.Hi), rune(r.Stride))
+		}
+		return u.normalize(), true
+	default:
+		return nil, false
+	}
+}
+
+func (a runeSet) normalize() runeSet {
+	sort.Slice(a, func(i, j int) bool {
+		return a[i].lo < a[j].lo
+	})
+	var r runeSet
+	for _, x := range a {
+		if x.lo > x.hi {
+			continue
+		}
+		n := len(r)
+		if n > 0 && x.lo <= r[n-1].hi+1 {
+			if x.hi > r[n-1].hi {
+				r[n-1].hi = x.hi
+			}
+			continue
+		}
+		r = append(r, x)
+	}
+	return r
+}
+
+func (a runeSet) union(b runeSet) runeSet {
+	u := make(runeSet, 0, len(a)+len(b))
+	u = append(u, a...)
+	u = append(u, b...)
+	return u.normalize()
+}
+
+func (a runeSet) invert() runeSet {
+	var r runeSet
+	next := rune(0)
+	for _, x := range a {
+		if x.lo > next {
+			r = append(r, runeInterval{next, x.lo - 1})
+		}
+		next = x.hi + 1
+	}
+	if next <= utf8.MaxRune {
+		r = append(r, runeInterval{next, utf8.MaxRune})
+	}
+	return r
+}
+
+func (a runeSet) intersect(b runeSet) runeSet {
+	var r runeSet
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		lo := max(a[i].lo, b[j].lo)
+		hi := min(a[i].hi, b[j].hi)
+		if lo <= hi {
+			r = append(r, runeInterval{lo, hi})
+		}
+		if a[i].hi < b[j].hi {
+			i++
+		} else {
+			j++
+		}
+	}
+	return r
+}
+
+func (a runeSet) empty() bool {
+	return len(a) == 0
+}
+
+func (a runeSet) subsetOf(b runeSet) bool {
+	return len(a.intersect(b.invert())) == 0
+}
+
+func (a runeSet) contains(x rune) bool {
+	i := sort.Search(len(a), func(i int) bool {
+		return a[i].hi >= x
+	})
+	return i < len(a) && a[i].lo <= x
+}
+
+func (a runeSet) size() int64 {
+	var n int64
+	for _, x := range a {
+		n += int64(x.hi-x.lo) + 1
+	}
+	return n
+}
+
+// nth returns the n-th rune of the set in ascending order.
+func (a runeSet) nth(n int64) rune {
+	for _, x := range a {
+		w := int64(x.hi-x.lo) + 1
+		if n < w {
+			return x.lo + rune(n)
+		}
+		n -= w
+	}
+	return utf8.RuneError
+}
+
+// subset converts the set back into a RuneSubset.
+func (a runeSet) subset() RuneSubset {
+	if len(a) == 1 && a[0].lo == 0 && a[0].hi == utf8.MaxRune {
+		return RuneAny{}
+	}
+	u := make(RuneUnion, 0, len(a))
+	for _, x := range a {
+		if x.lo == x.hi {
+			u = append(u, RuneValue(x.lo))
+		} else {
+			u = append(u, RuneRange{x.lo, x.hi})
+		}
+	}
+	if len(u) == 1 {
+		return u[0]
+	}
+	return u
+}
+
+// appendStride appends the runes from lo to hi, stride apart.
+func appendStride(u runeSet, lo, hi, stride rune) runeSet {
+	if stride == 1 {
+		return append(u, runeInterval{lo, hi})
+	}
+	for x := lo; x <= hi; x += stride {
+		u = append(u, runeInterval{x, x})
+	}
+	return u
+}
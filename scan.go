@@ -1,42 +1,508 @@
 package peg
 
+import (
+	"context"
+	"unicode/utf8"
+)
+
 type Memo struct {
 	Pos  int
 	Tree *Tree
+	// Reach is the end of the input examined to get the result, lookahead
+	// included. It is len(Text)+1 if the end of the input was detected.
+	Reach int
+	// lpos is the longest match reached while getting the result.
+	lpos int
 }
 
 type Scanner struct {
 	Text string
 	Pos  int
 	LPos int
-	memo map[int]map[string]Memo
+	memo memoTable
+	// cols are the rules whose results the columns of the memo table
+	// hold, and colOf finds the column of a rule by name.
+	cols  []memoColumn
+	colOf map[string]int
+
+	ctx      context.Context
+	maxSteps int
+	maxDepth int
+	maxMemo  int
+	steps    int
+	depth    int
+	nmemo    int
+	err      error
+
+	nomemo   bool
+	capacity int
+	order    []memoKey
+	stats    *Stats
+
+	arena *Arena
+	stack []*Tree
+
+	// reach is the end of the input examined by the current rule.
+	reach       int
+	incremental bool
+
+	expect *expectations
+
+	tracer     Tracer
+	traceExprs bool
+	traceDepth int
+}
+
+type memoKey struct {
+	pos int
+	id  int
+}
+
+type memoColumn struct {
+	name string
+	used bool
+}
+
+// ScannerOption configures a Scanner created by NewScanner.
+type ScannerOption func(*Scanner)
+
+// WithContext stops the parse with a *CanceledError once ctx is done.
+func WithContext(ctx context.Context) ScannerOption {
+	return func(s *Scanner) {
+		s.ctx = ctx
+	}
+}
+
+// WithMaxSteps stops the parse with a *StepLimitError after n expression
+// evaluations.
+func WithMaxSteps(n int) ScannerOption {
+	return func(s *Scanner) {
+		s.maxSteps = n
+	}
+}
+
+// WithMaxDepth stops the parse with a *DepthLimitError when rules nest
+// deeper than n.
+func WithMaxDepth(n int) ScannerOption {
+	return func(s *Scanner) {
+		s.maxDepth = n
+	}
+}
+
+// WithMaxMemo stops the parse with a *MemoLimitError when the memo table
+// would hold more than n entries.
+func WithMaxMemo(n int) ScannerOption {
+	return func(s *Scanner) {
+		s.maxMemo = n
+	}
+}
+
+// WithDefaultMemo sets whether rules without an explicit policy are
+// memoized. Rules marked with Rule.Memo or Rule.NoMemo are not affected.
+func WithDefaultMemo(on bool) ScannerOption {
+	return func(s *Scanner) {
+		s.nomemo = !on
+	}
+}
+
+// WithMemoCapacity bounds the memo table to n entries. When it is full the
+// oldest entry is evicted, which only costs reparsing.
+func WithMemoCapacity(n int) ScannerOption {
+	return func(s *Scanner) {
+		s.capacity = n
+	}
+}
+
+// WithStats makes the scanner collect statistics returned by Stats.
+func WithStats() ScannerOption {
+	return func(s *Scanner) {
+		s.stats = newStats()
+	}
+}
+
+// WithMapMemo stores memo entries in nested maps keyed by position and
+// rule name instead of the default dense table. It may use less memory
+// when few positions are memoized.
+func WithMapMemo() ScannerOption {
+	return func(s *Scanner) {
+		s.memo = newMapMemo(s)
+	}
 }
 
-func NewScanner(text string) *Scanner {
+// WithIncremental prepares the scanner for Edit. Rules then hand out
+// copies of their memoized trees, so that the trees kept in the memo table
+// are not changed by the choices and rules that use them, and Edit can
+// reuse them after an edit.
+func WithIncremental() ScannerOption {
+	return func(s *Scanner) {
+		s.incremental = true
+	}
+}
+
+func NewScanner(text string, opts ...ScannerOption) *Scanner {
 	s := new(Scanner)
 	s.Text = text
-	s.memo = make(map[int]map[string]Memo)
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.memo == nil {
+		s.memo = newDenseMemo(len(text))
+	}
 	return s
 }
 
+// Reset prepares the scanner to parse text with the same options. The
+// memory of the memo table is kept for reuse, while trees and results of
+// the previous parse are released.
+func (s *Scanner) Reset(text string) {
+	s.Text = text
+	s.Pos = 0
+	s.LPos = 0
+	s.memo.reset(len(text))
+	clear(s.cols)
+	s.cols = s.cols[:0]
+	clear(s.colOf)
+	s.steps = 0
+	s.depth = 0
+	s.nmemo = 0
+	s.err = nil
+	clear(s.order)
+	s.order = s.order[:0]
+	if s.stats != nil {
+		s.stats = newStats()
+	}
+	clear(s.stack)
+	s.stack = s.stack[:0]
+	s.reach = 0
+	s.traceDepth = 0
+}
+
+// Edit replaces deleted bytes at offset with inserted and prepares the
+// scanner to parse the new text again from the start. Memo entries that
+// examined only input before the edit are kept, and so are their trees,
+// which the next parse shares with the previous one. Entries that examined
+// only input after the edit are moved by the change in length; the others
+// are dropped.
+//
+// Only scanners created with WithIncremental keep entries that hold
+// trees. A plain scanner drops every entry stored by Parse and keeps only
+// those stored by Match, which a later Match reuses and Parse ignores, so
+// its next Parse starts from nothing.
+func (s *Scanner) Edit(offset, deleted int, inserted string) {
+	s.Text = s.Text[:offset] + inserted + s.Text[offset+deleted:]
+	delta := len(inserted) - deleted
+	type entry struct {
+		pos, id int
+		c       memoCell
+	}
+	var entries []entry
+	moved := make(map[memoKey]int)
+	s.memo.each(func(pos, id int, c memoCell) {
+		old := pos
+		switch {
+		case c.tree != nil && !s.incremental:
+			return
+		case c.reach <= offset:
+		case pos >= offset+deleted:
+			c.end += delta
+			c.reach += delta
+			c.lpos += delta
+			c.shift += delta
+			pos += delta
+		default:
+			return
+		}
+		entries = append(entries, entry{pos, id, c})
+		if s.capacity > 0 {
+			moved[memoKey{old, id}] = pos
+		}
+	})
+	s.memo.reset(len(s.Text))
+	for _, e := range entries {
+		s.memo.put(e.pos, e.id, e.c)
+	}
+	s.nmemo = len(entries)
+	order := s.order[:0]
+	for _, k := range s.order {
+		if pos, ok := moved[k]; ok {
+			order = append(order, memoKey{pos, k.id})
+		}
+	}
+	clear(s.order[len(order):])
+	s.order = order
+	s.Pos = 0
+	s.LPos = 0
+	s.steps = 0
+	s.depth = 0
+	s.err = nil
+	s.reach = 0
+	s.traceDepth = 0
+}
+
 func (s *Scanner) Longest() string {
 	return s.Text[:s.LPos]
 }
 
+// Stats returns the statistics collected so far, or nil if the scanner was
+// created without WithStats.
+func (s *Scanner) Stats() *Stats {
+	if s.stats != nil {
+		s.stats.Steps = s.steps
+	}
+	return s.stats
+}
+
+// Err returns the error that stopped the parse, or nil.
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+// ctxCheckInterval is the number of steps between context checks.
+const ctxCheckInterval = 256
+
+// parse evaluates a subexpression, enforcing the scanner limits.
+// Once a limit is hit every evaluation fails and Err reports why.
+func (s *Scanner) parse(e Expr) (*Tree, bool) {
+	if !s.step() {
+		return nil, false
+	}
+	if s.traceExprs {
+		// rules trace themselves
+		if _, ok := e.(*Rule); !ok {
+			return s.traceParse(nil, e, e.Parse)
+		}
+	}
+	return e.Parse(s)
+}
+
+func (s *Scanner) step() bool {
+	if s.err != nil {
+		return false
+	}
+	s.steps++
+	if s.maxSteps > 0 && s.steps > s.maxSteps {
+		s.err = &StepLimitError{Pos: s.Pos, Limit: s.maxSteps}
+		return false
+	}
+	if s.ctx != nil && s.steps%ctxCheckInterval == 0 {
+		if err := s.ctx.Err(); err != nil {
+			s.err = &CanceledError{Pos: s.Pos, Err: err}
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Scanner) enter() bool {
+	if s.err != nil {
+		return false
+	}
+	if s.ctx != nil && s.depth == 0 {
+		if err := s.ctx.Err(); err != nil {
+			s.err = &CanceledError{Pos: s.Pos, Err: err}
+			return false
+		}
+	}
+	s.depth++
+	if s.maxDepth > 0 && s.depth > s.maxDepth {
+		s.err = &DepthLimitError{Pos: s.Pos, Limit: s.maxDepth}
+		return false
+	}
+	return true
+}
+
+func (s *Scanner) leave() {
+	s.depth--
+}
+
+// enterRule is enter for a call of r at pos.
+func (s *Scanner) enterRule(r *Rule, pos int) bool {
+	if !s.enter() {
+		return false
+	}
+	if s.expect != nil {
+		s.expect.push(r, r.display, pos)
+	}
+	return true
+}
+
+func (s *Scanner) leaveRule() {
+	s.leave()
+	if s.expect != nil {
+		s.expect.pop()
+	}
+}
+
 func (s *Scanner) Memo(pos int, name string) (Memo, bool) {
-	x, ok := s.memo[pos]
+	id, ok := s.colOf[name]
 	if !ok {
 		return Memo{}, false
 	}
-	memo, ok := x[name]
-	return memo, ok
+	return s.memo.get(pos, id)
+}
+
+// EachMemo calls fn for every entry of the memo table, in no particular
+// order.
+func (s *Scanner) EachMemo(fn func(pos int, name string, memo Memo)) {
+	s.memo.each(func(pos, id int, c memoCell) {
+		fn(pos, s.cols[id].name, c.memo())
+	})
 }
 
 func (s *Scanner) SetMemo(pos int, name string, memo Memo) {
-	x, ok := s.memo[pos]
-	if !ok {
-		x = make(map[string]Memo)
+	s.setMemo(pos, s.column(name, -1), memo)
+}
+
+// ruleColumn returns the column of the memo table that holds the results
+// of r. It is the number of r in its grammar unless another rule of the
+// same number was parsed with the scanner first.
+func (s *Scanner) ruleColumn(r *Rule) int {
+	if !r.numbered.Load() {
+		number(r)
+	}
+	if r.id < len(s.cols) {
+		if c := s.cols[r.id]; c.used && c.name == r.name {
+			return r.id
+		}
+	}
+	return s.column(r.name, r.id)
+}
+
+// column returns the column of name, taking column id if it is still free
+// or a new one otherwise.
+func (s *Scanner) column(name string, id int) int {
+	if col, ok := s.colOf[name]; ok {
+		return col
+	}
+	if id < 0 || id < len(s.cols) && s.cols[id].used {
+		id = len(s.cols)
+	}
+	for id >= len(s.cols) {
+		s.cols = append(s.cols, memoColumn{})
+	}
+	s.cols[id] = memoColumn{name: name, used: true}
+	if s.colOf == nil {
+		s.colOf = make(map[string]int)
+	}
+	s.colOf[name] = id
+	return id
+}
+
+func (s *Scanner) setMemo(pos, id int, memo Memo) {
+	if s.maxMemo > 0 && s.nmemo >= s.maxMemo {
+		if _, ok := s.memo.get(pos, id); !ok {
+			if s.err == nil {
+				s.err = &MemoLimitError{Pos: pos, Limit: s.maxMemo}
+			}
+			return
+		}
+	}
+	if !s.memo.set(pos, id, memo) {
+		return
+	}
+	s.nmemo++
+	if s.capacity > 0 {
+		s.order = append(s.order, memoKey{pos, id})
+		if s.nmemo > s.capacity {
+			s.evict()
+		}
+	}
+}
+
+func (s *Scanner) evict() {
+	k := s.order[0]
+	s.order = s.order[1:]
+	s.memo.del(k.pos, k.id)
+	s.nmemo--
+	if s.stats != nil {
+		s.stats.Evictions++
+	}
+}
+
+// recall looks up the result of r at pos. If tree is set, entries stored
+// by Match are not reported.
+func (s *Scanner) recall(r *Rule, pos int, tree bool) (Memo, bool) {
+	memo, ok := s.memo.get(pos, s.ruleColumn(r))
+	ok = ok && (!tree || memo.Tree != nil)
+	if s.stats != nil {
+		stats := s.stats.rule(r.name)
+		if ok {
+			stats.Hits++
+			s.stats.Hits++
+		} else {
+			stats.Misses++
+			s.stats.Misses++
+		}
+	}
+	return memo, ok
+}
+
+// reuse returns a memoized tree for use by the caller.
+func (s *Scanner) reuse(t *Tree) *Tree {
+	if s.incremental && t != nil {
+		return t.clone()
+	}
+	return t
+}
+
+func (s *Scanner) store(r *Rule, pos int, memo Memo) {
+	if s.stats != nil {
+		s.stats.rule(r.name).Stores++
+		s.stats.Stores++
+	}
+	s.setMemo(pos, s.ruleColumn(r), memo)
+}
+
+func (s *Scanner) newTree(pos int) *Tree {
+	if s.arena != nil {
+		return s.arena.tree(pos)
+	}
+	return NewTree(pos)
+}
+
+// children returns an empty child list with room for n trees.
+func (s *Scanner) children(n int) []*Tree {
+	if s.arena != nil {
+		return s.arena.children(n)
+	}
+	if n == 0 {
+		return nil
+	}
+	return make([]*Tree, 0, n)
+}
+
+// memoize reports whether results of r are kept in the memo table.
+func (s *Scanner) memoize(r *Rule) bool {
+	if s.expect != nil {
+		return false
+	}
+	switch r.policy {
+	case memoOn:
+		return true
+	case memoOff:
+		return false
+	default:
+		return !s.nomemo
+	}
+}
+
+// examine records that the input before end was read. Reading at
+// len(Text), which detects the end of the input, counts as len(Text)+1.
+func (s *Scanner) examine(end int) {
+	if end > s.reach {
+		s.reach = end
+	}
+}
+
+// examineRune records the input read to decode a rune of size bytes at
+// pos. Decoding an invalid sequence may look at up to utf8.UTFMax bytes.
+func (s *Scanner) examineRune(pos, size int) {
+	switch {
+	case size == 0:
+		s.examine(pos + 1)
+	case size == 1 && s.Text[pos] >= utf8.RuneSelf:
+		s.examine(min(pos+utf8.UTFMax, len(s.Text)+1))
+	default:
+		s.examine(pos + size)
 	}
-	x[name] = memo
-	s.memo[pos] = x
 }
@@ -13,10 +13,11 @@ func NewSequence(exprs ...Expr) *Sequence {
 }
 
 func (s *Sequence) Parse(scan *Scanner) (*Tree, bool) {
-	t := NewTree(scan.Pos)
+	t := scan.newTree(scan.Pos)
+	t.Child = scan.children(len(s.exprs))
 	pos := scan.Pos
 	for _, expr := range s.exprs {
-		child, ok := expr.Parse(scan)
+		child, ok := scan.parse(expr)
 		if !ok {
 			scan.Pos = pos
 			return t, false
@@ -25,3 +26,14 @@ func (s *Sequence) Parse(scan *Scanner) (*Tree, bool) {
 	}
 	return t, true
 }
+
+func (s *Sequence) Match(scan *Scanner) bool {
+	pos := scan.Pos
+	for _, expr := range s.exprs {
+		if !scan.match(expr) {
+			scan.Pos = pos
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,86 @@
+package peg
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Stats holds counters collected by a scanner created with WithStats.
+type Stats struct {
+	Steps     int
+	Hits      int
+	Misses    int
+	Stores    int
+	Evictions int
+	Rules     map[string]*RuleStats
+}
+
+// RuleStats holds the counters of a single rule.
+type RuleStats struct {
+	Calls  int
+	Hits   int
+	Misses int
+	Stores int
+}
+
+func newStats() *Stats {
+	s := new(Stats)
+	s.Rules = make(map[string]*RuleStats)
+	return s
+}
+
+func (s *Stats) rule(name string) *RuleStats {
+	r, ok := s.Rules[name]
+	if !ok {
+		r = new(RuleStats)
+		s.Rules[name] = r
+	}
+	return r
+}
+
+// HitRate returns the fraction of memo lookups that were hits.
+func (s *Stats) HitRate() float64 {
+	return hitRate(s.Hits, s.Misses)
+}
+
+// HitRate returns the fraction of memo lookups of the rule that were hits.
+func (r *RuleStats) HitRate() float64 {
+	return hitRate(r.Hits, r.Misses)
+}
+
+func hitRate(hits, misses int) float64 {
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+// Write prints a table of the rule counters sorted by number of calls.
+func (s *Stats) Write(w io.Writer) error {
+	names := make([]string, 0, len(s.Rules))
+	for name := range s.Rules {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := s.Rules[names[i]], s.Rules[names[j]]
+		if a.Calls != b.Calls {
+			return a.Calls > b.Calls
+		}
+		return names[i] < names[j]
+	})
+	_, err := fmt.Fprintf(w, "%-20s %10s %10s %10s %10s %8s\n", "rule", "calls", "hits", "misses", "stores", "hitrate")
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		r := s.Rules[name]
+		_, err := fmt.Fprintf(w, "%-20s %10d %10d %10d %10d %7.1f%%\n", name, r.Calls, r.Hits, r.Misses, r.Stores, 100*r.HitRate())
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "steps %d, hits %d, misses %d, stores %d, evictions %d, hitrate %.1f%%\n",
+		s.Steps, s.Hits, s.Misses, s.Stores, s.Evictions, 100*s.HitRate())
+	return err
+}
@@ -0,0 +1,137 @@
+package peg
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// suggestions returns the keywords the grammar tried where the misspelled
+// word ends up failing that are closest to the word in the text.
+//
+// A keyword that matched the first letters of the word is recorded at the
+// start of the word, while the others failed there without reaching the
+// longest match. The grammar is completed once more up to the start of the
+// word, so that every keyword tried there is a candidate.
+func suggestions(expr Expr, text string, items []Expected, lpos int) []string {
+	var starts []int
+	seen := make(map[int]bool)
+	for _, e := range items {
+		if e.Kind == ExpectLiteral && !seen[e.Pos] {
+			seen[e.Pos] = true
+			starts = append(starts, e.Pos)
+		}
+	}
+	var list []string
+	for _, pos := range starts {
+		word := wordAt(text, pos)
+		if word == "" {
+			continue
+		}
+		tried := items
+		if pos < lpos {
+			tried = Complete(expr, text[:pos]).Expected
+		}
+		var keywords []string
+		for _, e := range tried {
+			if e.Kind == ExpectLiteral && e.Pos == pos && isWord(e.Text) {
+				keywords = append(keywords, e.Text)
+			}
+		}
+		list = append(list, suggest(word, keywords)...)
+	}
+	return list
+}
+
+// suggest returns the candidates closest to word by edit distance, in
+// their order. A candidate is close if at most a third of it differs.
+func suggest(word string, candidates []string) []string {
+	var list []string
+	best := -1
+	seen := make(map[string]bool)
+	for _, c := range candidates {
+		if c == word || seen[c] {
+			continue
+		}
+		seen[c] = true
+		d := editDistance(word, c)
+		if d > (utf8.RuneCountInString(c)+1)/3 {
+			continue
+		}
+		switch {
+		case best < 0 || d < best:
+			best = d
+			list = []string{c}
+		case d == best:
+			list = append(list, c)
+		}
+	}
+	return list
+}
+
+// editDistance returns the number of rune insertions, deletions,
+// substitutions and transpositions of adjacent runes needed to turn a
+// into b.
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	// rows i-2, i-1 and i of the distances between prefixes
+	prev2 := make([]int, len(t)+1)
+	prev := make([]int, len(t)+1)
+	cur := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		cur[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(t)]
+}
+
+// wordAt returns the word starting at pos in text.
+func wordAt(text string, pos int) string {
+	end := pos
+	for end < len(text) {
+		ch, size := utf8.DecodeRuneInString(text[end:])
+		if !isWordRune(ch) {
+			break
+		}
+		end += size
+	}
+	return text[pos:end]
+}
+
+func isWord(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, ch := range s {
+		if !isWordRune(ch) {
+			return false
+		}
+	}
+	return true
+}
+
+func isWordRune(ch rune) bool {
+	return unicode.IsLetter(ch) || unicode.IsDigit(ch) || ch == '_' || ch == '-'
+}
+
+// didYouMean formats the suggestions as a question.
+func didYouMean(list []string) string {
+	quoted := make([]string, len(list))
+	for i, s := range list {
+		quoted[i] = fmt.Sprintf("%q", s)
+	}
+	return "did you mean " + joinOr(quoted) + "?"
+}
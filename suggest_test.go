@@ -0,0 +1,81 @@
+package peg
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "leaf", 4},
+		{"leaf", "leaf", 0},
+		{"contianer", "container", 1},
+		{"contaner", "container", 1},
+		{"containerr", "container", 1},
+		{"lsit", "list", 1},
+		{"leaf", "list", 3},
+		{"grüße", "grusse", 3},
+	}
+	for _, tc := range tests {
+		if got := editDistance(tc.a, tc.b); got != tc.want {
+			t.Errorf("editDistance(%q, %q) = %v; want %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestDiagnoseSuggestions(t *testing.T) {
+	stmt := NewRule("suggestStmt")
+	keyword := NewRule("suggestKeyword")
+
+	// suggestStmt <- suggestKeyword " " [a-z]+ ";"
+	stmt.Define(NewSequence(
+		keyword,
+		NewLiteral(" "),
+		NewOneOrMore(NewCharclass(RuneRange{'a', 'z'})),
+		NewLiteral(";"),
+		EOT,
+	))
+	// suggestKeyword <- "container" / "leaf-list" / "leaf" / "list"
+	keyword.Define(NewChoice(
+		NewLiteral("container"),
+		NewLiteral("leaf-list"),
+		NewLiteral("leaf"),
+		NewLiteral("list"),
+	))
+
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"contianer foo;", []string{"container"}},
+		{"contaner foo;", []string{"container"}},
+		{"lsit foo;", []string{"list"}},
+		{"leaf-lst foo;", []string{"leaf-list"}},
+		{"leef foo;", []string{"leaf"}},
+		{"choice foo;", nil},
+		{"leaf foo", nil},
+	}
+	for _, g := range []Expr{stmt, Optimize(stmt)} {
+		for _, tc := range tests {
+			scan := NewScanner(tc.text)
+			if _, ok := g.Parse(scan); ok {
+				t.Fatalf("%q: accepted", tc.text)
+			}
+			d := Diagnose(g, scan, "")
+			if !slices.Equal(d.Suggestions, tc.want) {
+				t.Errorf("%q: want %q; but got %q (%v)", tc.text, tc.want, d.Suggestions, d.Message)
+			}
+		}
+	}
+
+	scan := NewScanner("contianer foo;")
+	stmt.Parse(scan)
+	want := `1:5: expected "container", found 'i'; did you mean "container"?`
+	if got := Diagnose(stmt, scan, "").Error(); got != want {
+		t.Errorf("want %q; but got %q", want, got)
+	}
+}
@@ -15,10 +15,21 @@ func NewTag(name string, expr Expr) *Tag {
 }
 
 func (t *Tag) Parse(scan *Scanner) (*Tree, bool) {
-	child, ok := t.expr.Parse(scan)
+	child, ok := scan.parse(t.expr)
+	if !ok {
+		return child, false
+	}
+	// the tree of a rule is shared through the memo, so that a tag of an
+	// alternative that fails later does not stay on it
 	if child == nil {
-		child = NewTree(scan.Pos)
+		child = scan.newTree(scan.Pos)
+	} else {
+		child = child.clone()
 	}
 	child.SetTag(t.name)
-	return child, ok
+	return child, true
+}
+
+func (t *Tag) Match(scan *Scanner) bool {
+	return scan.match(t.expr)
 }
@@ -0,0 +1,65 @@
+package peg
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+var _ Tracer = &TextTracer{}
+
+// TextTracer writes one line per event, indented by the depth of the call:
+//
+//	> addr @0
+//	  > oct @0
+//	  < oct @0 matched 0-3
+//	  > oct @4 (memo hit)
+//	  < oct @4 matched 4-7 (memo hit)
+//	< addr @0 failed, backtracked 8 bytes
+type TextTracer struct {
+	w   io.Writer
+	err error
+}
+
+func NewTextTracer(w io.Writer) *TextTracer {
+	t := new(TextTracer)
+	t.w = w
+	return t
+}
+
+func (t *TextTracer) Enter(ev TraceEvent) {
+	t.printf("%s> %s @%d%s\n", t.indent(ev), ev.Name, ev.Pos, memoNote(ev))
+}
+
+func (t *TextTracer) Exit(ev TraceEvent) {
+	switch {
+	case ev.OK:
+		t.printf("%s< %s @%d matched %d-%d%s\n", t.indent(ev), ev.Name, ev.Pos, ev.Pos, ev.End, memoNote(ev))
+	case ev.Backtrack > 0:
+		t.printf("%s< %s @%d failed, backtracked %d bytes%s\n", t.indent(ev), ev.Name, ev.Pos, ev.Backtrack, memoNote(ev))
+	default:
+		t.printf("%s< %s @%d failed%s\n", t.indent(ev), ev.Name, ev.Pos, memoNote(ev))
+	}
+}
+
+// Err returns the first error writing the trace. Later events are dropped.
+func (t *TextTracer) Err() error {
+	return t.err
+}
+
+func (t *TextTracer) indent(ev TraceEvent) string {
+	return strings.Repeat("  ", ev.Depth)
+}
+
+func (t *TextTracer) printf(format string, args ...any) {
+	if t.err == nil {
+		_, t.err = fmt.Fprintf(t.w, format, args...)
+	}
+}
+
+func memoNote(ev TraceEvent) string {
+	if ev.Memo == MemoHit {
+		return " (memo hit)"
+	}
+	return ""
+}
@@ -0,0 +1,178 @@
+package peg
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Tracer receives an Enter event when a rule, or an expression if traced,
+// starts at a position and an Exit event when it returns. Enter and Exit
+// events are nested like the calls.
+type Tracer interface {
+	Enter(ev TraceEvent)
+	Exit(ev TraceEvent)
+}
+
+// MemoResult tells how the memo table answered a rule call.
+type MemoResult int
+
+const (
+	// MemoNone is for expressions and rules that are not memoized.
+	MemoNone MemoResult = iota
+	MemoHit
+	MemoMiss
+)
+
+func (m MemoResult) String() string {
+	switch m {
+	case MemoHit:
+		return "hit"
+	case MemoMiss:
+		return "miss"
+	default:
+		return "none"
+	}
+}
+
+// TraceEvent describes a call of a rule or an expression.
+type TraceEvent struct {
+	// Rule is the rule called, or nil for an expression.
+	Rule *Rule
+	Expr Expr
+	// Name is the name of the rule or a short description of the
+	// expression.
+	Name  string
+	Depth int
+	Pos   int
+	Memo  MemoResult
+	// The fields below are set on Exit. End is where the match ends. When
+	// the call fails, Backtrack is the length of the input it matched
+	// before failing, which the parse gives up.
+	OK        bool
+	End       int
+	Backtrack int
+}
+
+// WithTracer reports the rule calls of the parse to t.
+func WithTracer(t Tracer) ScannerOption {
+	return func(s *Scanner) {
+		s.tracer = t
+	}
+}
+
+// WithExprTracer reports the calls of every expression of the parse to t,
+// rules included.
+func WithExprTracer(t Tracer) ScannerOption {
+	return func(s *Scanner) {
+		s.tracer = t
+		s.traceExprs = true
+	}
+}
+
+// interpreted reports whether compiled expressions must run their source,
+// because completion or a tracer looks at every rule call.
+func (s *Scanner) interpreted() bool {
+	return s.expect != nil || s.tracer != nil
+}
+
+// traceCall is a call being traced.
+type traceCall struct {
+	ev   TraceEvent
+	lpos int
+}
+
+// traceEnter reports the call of r, or of e if r is nil. If tree is set,
+// memo entries stored by Match do not count as hits.
+func (s *Scanner) traceEnter(r *Rule, e Expr, tree bool) traceCall {
+	ev := TraceEvent{Rule: r, Expr: e, Depth: s.traceDepth, Pos: s.Pos}
+	if r != nil {
+		ev.Name = r.name
+		if s.memoize(r) {
+			ev.Memo = MemoMiss
+			if m, ok := s.memo.get(s.Pos, s.ruleColumn(r)); ok && (!tree || m.Tree != nil) {
+				ev.Memo = MemoHit
+			}
+		}
+	} else {
+		ev.Name = exprName(e)
+	}
+	s.tracer.Enter(ev)
+	// the call records how far it matched, as rules do
+	c := traceCall{ev, s.LPos}
+	s.LPos = s.Pos
+	s.traceDepth++
+	return c
+}
+
+func (s *Scanner) traceExit(c traceCall, ok bool) {
+	s.traceDepth--
+	longest := s.LPos
+	s.LPos = max(c.lpos, longest)
+	ev := c.ev
+	ev.OK = ok
+	if ok {
+		ev.End = s.Pos
+	} else {
+		ev.End = ev.Pos
+		ev.Backtrack = max(longest-ev.Pos, 0)
+	}
+	s.tracer.Exit(ev)
+}
+
+func (s *Scanner) traceParse(r *Rule, e Expr, parse func(*Scanner) (*Tree, bool)) (*Tree, bool) {
+	c := s.traceEnter(r, e, true)
+	t, ok := parse(s)
+	s.traceExit(c, ok)
+	return t, ok
+}
+
+func (s *Scanner) traceMatch(r *Rule, e Expr, match func(*Scanner) bool) bool {
+	c := s.traceEnter(r, e, false)
+	ok := match(s)
+	s.traceExit(c, ok)
+	return ok
+}
+
+// exprName describes an expression in a few words.
+func exprName(e Expr) string {
+	switch e := e.(type) {
+	case *Rule:
+		return e.name
+	case *Literal:
+		return strconv.Quote(e.text)
+	case *Charclass:
+		rs, ok := newRuneSet(e.set)
+		if !ok {
+			return "charclass"
+		}
+		ranges := make([]RuneRange, len(rs))
+		for i, r := range rs {
+			ranges[i] = RuneRange{r.lo, r.hi}
+		}
+		return Expected{Kind: ExpectClass, Ranges: ranges}.String()
+	case *Sequence:
+		return "sequence"
+	case *Choice:
+		return "choice"
+	case *Repeat:
+		return "repeat"
+	case *Optional:
+		return "optional"
+	case *And:
+		return "and"
+	case *Not:
+		return "not"
+	case *Tag:
+		return "tag " + e.name
+	case *Expect:
+		return "expect " + strconv.Quote(e.msg)
+	case *literalSet:
+		return "literal set"
+	case *DFA:
+		return "dfa"
+	case *VM:
+		return "vm"
+	default:
+		return fmt.Sprintf("%T", e)
+	}
+}
@@ -0,0 +1,105 @@
+package peg
+
+import (
+	"bufio"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func newTracePairGrammar() *Rule {
+	pair := NewRule("tracePair")
+	num := NewRule("traceNum")
+
+	// tracePair <- traceNum "-" traceNum / traceNum "." traceNum
+	pair.Define(NewChoice(
+		NewSequence(num, NewLiteral("-"), num),
+		NewSequence(num, NewLiteral("."), num),
+	))
+	// traceNum <- [0-9]+
+	num.Define(NewOneOrMore(NewCharclass(RuneRange{'0', '9'})))
+	return pair
+}
+
+func TestTextTracer(t *testing.T) {
+	g := newTracePairGrammar()
+	var sb strings.Builder
+	tracer := NewTextTracer(&sb)
+	if _, ok := g.Parse(NewScanner("12.3x", WithTracer(tracer))); !ok {
+		t.Fatal("not accepted")
+	}
+	want := `> tracePair @0
+  > traceNum @0
+  < traceNum @0 matched 0-2
+  > traceNum @0 (memo hit)
+  < traceNum @0 matched 0-2 (memo hit)
+  > traceNum @3
+  < traceNum @3 matched 3-4
+< tracePair @0 matched 0-4
+`
+	if sb.String() != want {
+		t.Errorf("want\n%s\nbut got\n%s", want, sb.String())
+	}
+
+	sb.Reset()
+	g.Parse(NewScanner("1.x", WithTracer(tracer)))
+	want = "< tracePair @0 failed, backtracked 2 bytes\n"
+	if !strings.HasSuffix(sb.String(), want) {
+		t.Errorf("want suffix %q; but got\n%s", want, sb.String())
+	}
+}
+
+func TestJSONTracer(t *testing.T) {
+	g := newTracePairGrammar()
+	var sb strings.Builder
+	g.Parse(NewScanner("12.3", WithExprTracer(NewJSONTracer(&sb))))
+
+	var depth int
+	names := make(map[string]bool)
+	sc := bufio.NewScanner(strings.NewReader(sb.String()))
+	for sc.Scan() {
+		var ev jsonEvent
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			t.Fatal(err)
+		}
+		names[ev.Name] = true
+		switch ev.Event {
+		case "enter":
+			if ev.Depth != depth {
+				t.Errorf("%s: depth %v; want %v", sc.Text(), ev.Depth, depth)
+			}
+			depth++
+		case "exit":
+			depth--
+			if ev.Depth != depth || ev.OK == nil {
+				t.Errorf("%s: bad exit", sc.Text())
+			}
+		}
+	}
+	if depth != 0 {
+		t.Errorf("unbalanced events: depth %v", depth)
+	}
+	for _, name := range []string{"tracePair", "traceNum", "choice", "sequence", `"-"`, `"."`, "['0'-'9']", "repeat"} {
+		if !names[name] {
+			t.Errorf("no events for %v", name)
+		}
+	}
+}
+
+func TestTracerEngines(t *testing.T) {
+	g := newTracePairGrammar()
+	trace := func(e Expr, text string) string {
+		var sb strings.Builder
+		e.Parse(NewScanner(text, WithTracer(NewTextTracer(&sb))))
+		return sb.String()
+	}
+	vm, err := Compile(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range []string{"12.3", "12-", "x"} {
+		if want, got := trace(g, text), trace(vm, text); got != want {
+			t.Errorf("%q: want\n%s\nbut got\n%s", text, want, got)
+		}
+	}
+}
@@ -1,11 +1,20 @@
 package peg
 
+import (
+	"maps"
+	"slices"
+)
+
 type Tree struct {
 	Start int
 	End   int
 	Child []*Tree
 	Tags  map[string]struct{}
 	Index int
+
+	// tagList holds the tags of trees without a Tags map, such as trees
+	// allocated from an Arena.
+	tagList []string
 }
 
 func NewTree(pos int) *Tree {
@@ -24,5 +33,92 @@ func (t *Tree) Append(c *Tree) {
 }
 
 func (t *Tree) SetTag(name string) {
-	t.Tags[name] = struct{}{}
+	if t.Tags != nil {
+		t.Tags[name] = struct{}{}
+		return
+	}
+	if !slices.Contains(t.tagList, name) {
+		t.tagList = append(t.tagList, name)
+	}
+}
+
+// HasTag reports whether the tree carries the tag, whichever way it is
+// stored.
+func (t *Tree) HasTag(name string) bool {
+	if _, ok := t.Tags[name]; ok {
+		return true
+	}
+	return slices.Contains(t.tagList, name)
+}
+
+// TagNames returns the tags of the tree in no particular order.
+func (t *Tree) TagNames() []string {
+	names := make([]string, 0, len(t.Tags)+len(t.tagList))
+	for name := range t.Tags {
+		names = append(names, name)
+	}
+	return append(names, t.tagList...)
+}
+
+// Find returns the first tree carrying the tag in t and its descendants,
+// in depth-first order, or nil.
+func (t *Tree) Find(name string) *Tree {
+	if t == nil {
+		return nil
+	}
+	if t.HasTag(name) {
+		return t
+	}
+	for _, c := range t.Child {
+		if found := c.Find(name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// FindAll returns the trees carrying the tag in t and its descendants, in
+// depth-first order.
+func (t *Tree) FindAll(name string) []*Tree {
+	var list []*Tree
+	var visit func(*Tree)
+	visit = func(t *Tree) {
+		if t == nil {
+			return
+		}
+		if t.HasTag(name) {
+			list = append(list, t)
+		}
+		for _, c := range t.Child {
+			visit(c)
+		}
+	}
+	visit(t)
+	return list
+}
+
+// clone returns a copy of the tree node that shares its children.
+func (t *Tree) clone() *Tree {
+	c := *t
+	if t.Tags != nil {
+		c.Tags = maps.Clone(t.Tags)
+	}
+	c.tagList = slices.Clone(t.tagList)
+	return &c
+}
+
+// shift returns a copy of the tree moved by delta bytes.
+func (t *Tree) shift(delta int) *Tree {
+	c := t.clone()
+	c.Start += delta
+	c.End += delta
+	if t.Child != nil {
+		c.Child = make([]*Tree, len(t.Child))
+		for i, child := range t.Child {
+			if child != nil {
+				c.Child[i] = child.shift(delta)
+			}
+		}
+	}
+	return c
 }
@@ -0,0 +1,605 @@
+package peg
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+var _ Expr = &VM{}
+
+type opcode uint8
+
+const (
+	// leaves: match input and push a leaf tree
+	opChar opcode = iota
+	opString
+	opSet
+	// control
+	opTestChar
+	opTestSet
+	opChoice
+	opPredChoice
+	opCommit
+	opBackCommit
+	opFailTwice
+	opFail
+	opCall
+	opReturn
+	opEnd
+	// captures: build trees on the value stack
+	opOpen
+	opClose
+	opRepeatCheck
+	opRepeatCommit
+	opRepeatClose
+	opPushNil
+	opIndex
+	opTag
+	opRuleTag
+	// fallback to the interpreter
+	opExpr
+)
+
+// inst is an instruction. x is the main operand: a jump target or an
+// index into one of the VM tables. Calls and repeat checks also carry a
+// jump target in y, and opTestSet the index of its set.
+type inst struct {
+	op opcode
+	b  byte
+	x  int
+	y  int
+}
+
+// VM runs a grammar compiled by Compile. It parses with an explicit
+// backtrack stack instead of recursive calls, so deep nesting does not
+// grow the Go stack, and produces the same trees and longest match as the
+// interpreter. Rules are memoized according to the scanner settings.
+//
+// Parsing the meta-grammar with the VM takes about half the time it takes
+// the interpreter, mostly because the VM allocates fewer trees. Match and
+// short inputs, where the memo table costs as much as the expressions,
+// gain little; BenchmarkVM in cmd/gen and examples/codegen-ipv6 measures
+// both.
+type VM struct {
+	expr    Expr
+	code    []inst
+	strs    []string
+	sets    []RuneSubset
+	rules   []*Rule
+	exprs   []Expr
+	limits  []*Limit
+	tags    []string
+	entries map[*Rule]int
+}
+
+// Compile translates the expression graph reachable from expr into
+// instructions for a VM. Expressions of other packages are kept and
+// evaluated with their own Parse method.
+func Compile(expr Expr) (*VM, error) {
+	c := &compiler{
+		vm: &VM{
+			expr:    expr,
+			entries: make(map[*Rule]int),
+		},
+	}
+	if err := c.expr(expr); err != nil {
+		return nil, err
+	}
+	c.emit(inst{op: opEnd})
+	for i := 0; i < len(c.vm.rules); i++ {
+		r := c.vm.rules[i]
+		if r.expr == nil {
+			return nil, fmt.Errorf("rule %v is not defined", r.name)
+		}
+		c.vm.entries[r] = len(c.vm.code)
+		if err := c.expr(r.expr); err != nil {
+			return nil, err
+		}
+		c.emit(inst{op: opRuleTag, x: i})
+		c.emit(inst{op: opReturn})
+	}
+	for _, pc := range c.calls {
+		r := c.vm.rules[c.vm.code[pc].x]
+		c.vm.code[pc].y = c.vm.entries[r]
+	}
+	return c.vm, nil
+}
+
+type compiler struct {
+	vm    *VM
+	rules map[*Rule]int
+	calls []int
+}
+
+func (c *compiler) emit(i inst) int {
+	c.vm.code = append(c.vm.code, i)
+	return len(c.vm.code) - 1
+}
+
+func (c *compiler) here() int {
+	return len(c.vm.code)
+}
+
+// patch makes the instructions at pcs jump to the next instruction.
+func (c *compiler) patch(pcs ...int) {
+	for _, pc := range pcs {
+		c.vm.code[pc].x = c.here()
+	}
+}
+
+// choice emits a choice instruction of kind op before the code of e. If e
+// starts with a literal or charclass, a test of the input comes first, so
+// that e is skipped without a backtrack entry when it cannot match. It
+// returns the instructions that patch must make jump past e.
+func (c *compiler) choice(op opcode, e Expr) []int {
+	var pcs []int
+	switch h := head(e).(type) {
+	case *Literal:
+		pcs = append(pcs, c.emit(inst{op: opTestChar, b: h.text[0]}))
+	case *Charclass:
+		c.vm.sets = append(c.vm.sets, h.set)
+		pcs = append(pcs, c.emit(inst{op: opTestSet, y: len(c.vm.sets) - 1}))
+	}
+	return append(pcs, c.emit(inst{op: op}))
+}
+
+// head returns the literal or charclass that e starts with, if e fails
+// whenever it does.
+func head(e Expr) Expr {
+	switch e := e.(type) {
+	case *Literal:
+		if e.text != "" {
+			return e
+		}
+	case *Charclass:
+		return e
+	case *Sequence:
+		if len(e.exprs) > 0 {
+			return head(e.exprs[0])
+		}
+	case *Tag:
+		return head(e.expr)
+	case *Expect:
+		return head(e.expr)
+	}
+	return nil
+}
+
+func (c *compiler) rule(r *Rule) int {
+	if c.rules == nil {
+		c.rules = make(map[*Rule]int)
+	}
+	i, ok := c.rules[r]
+	if !ok {
+		i = len(c.vm.rules)
+		c.rules[r] = i
+		c.vm.rules = append(c.vm.rules, r)
+	}
+	return i
+}
+
+func (c *compiler) expr(e Expr) error {
+	vm := c.vm
+	switch e := e.(type) {
+	case *Literal:
+		if len(e.text) == 1 {
+			c.emit(inst{op: opChar, b: e.text[0]})
+			return nil
+		}
+		vm.strs = append(vm.strs, e.text)
+		c.emit(inst{op: opString, x: len(vm.strs) - 1})
+	case *Charclass:
+		vm.sets = append(vm.sets, e.set)
+		c.emit(inst{op: opSet, x: len(vm.sets) - 1})
+	case *Sequence:
+		c.emit(inst{op: opOpen})
+		for _, child := range e.exprs {
+			if err := c.expr(child); err != nil {
+				return err
+			}
+		}
+		c.emit(inst{op: opClose})
+	case *Choice:
+		if len(e.exprs) == 0 {
+			c.emit(inst{op: opFail})
+			return nil
+		}
+		var commits []int
+		for i, child := range e.exprs {
+			last := i == len(e.exprs)-1
+			var choice []int
+			if !last {
+				choice = c.choice(opChoice, child)
+			}
+			if err := c.expr(child); err != nil {
+				return err
+			}
+			c.emit(inst{op: opIndex, x: i})
+			if !last {
+				commits = append(commits, c.emit(inst{op: opCommit}))
+				c.patch(choice...)
+			}
+		}
+		for _, pc := range commits {
+			c.patch(pc)
+		}
+	case *Optional:
+		choice := c.choice(opChoice, e.expr)
+		if err := c.expr(e.expr); err != nil {
+			return err
+		}
+		commit := c.emit(inst{op: opCommit})
+		c.patch(choice...)
+		c.emit(inst{op: opPushNil})
+		c.patch(commit)
+	case *Repeat:
+		vm.limits = append(vm.limits, e.limit)
+		limit := len(vm.limits) - 1
+		c.emit(inst{op: opOpen})
+		loop := c.here()
+		check := c.emit(inst{op: opRepeatCheck, x: limit})
+		choice := c.choice(opChoice, e.expr)
+		if err := c.expr(e.expr); err != nil {
+			return err
+		}
+		c.emit(inst{op: opRepeatCommit, x: loop})
+		c.patch(choice...)
+		c.emit(inst{op: opRepeatClose, x: limit})
+		// opRepeatCheck jumps to the close instruction when full
+		c.vm.code[check].y = c.here() - 1
+	case *And:
+		choice := c.choice(opPredChoice, e.expr)
+		if err := c.expr(e.expr); err != nil {
+			return err
+		}
+		commit := c.emit(inst{op: opBackCommit})
+		c.patch(choice...)
+		c.emit(inst{op: opFail})
+		c.patch(commit)
+		c.emit(inst{op: opPushNil})
+	case *Not:
+		choice := c.choice(opPredChoice, e.expr)
+		if err := c.expr(e.expr); err != nil {
+			return err
+		}
+		c.emit(inst{op: opFailTwice})
+		c.patch(choice...)
+		c.emit(inst{op: opPushNil})
+	case *Tag:
+		if err := c.expr(e.expr); err != nil {
+			return err
+		}
+		vm.tags = append(vm.tags, e.name)
+		c.emit(inst{op: opTag, x: len(vm.tags) - 1})
+	case *Expect:
+		// labels only matter to Complete, which runs the interpreter
+		return c.expr(e.expr)
+	case *Rule:
+		c.calls = append(c.calls, c.emit(inst{op: opCall, x: c.rule(e)}))
+	case nil:
+		return fmt.Errorf("nil expression")
+	default:
+		vm.exprs = append(vm.exprs, e)
+		c.emit(inst{op: opExpr, x: len(vm.exprs) - 1})
+	}
+	return nil
+}
+
+type entryKind uint8
+
+const (
+	entryChoice entryKind = iota
+	entryPred
+	entryCall
+)
+
+// vmEntry is an element of the backtrack stack.
+type vmEntry struct {
+	kind   entryKind
+	pc     int
+	pos    int
+	lpos   int
+	vals   int
+	frames int
+	rule   int
+	// reach is the reach of the caller, saved by a call with its lpos.
+	reach int
+}
+
+// vmFrame marks the start of a tree under construction.
+type vmFrame struct {
+	pos  int
+	vals int
+}
+
+type vmState struct {
+	stack  []vmEntry
+	vals   []*Tree
+	frames []vmFrame
+}
+
+func (vm *VM) Parse(scan *Scanner) (*Tree, bool) {
+	// Complete and tracers need the rule calls of the interpreter
+	if scan.interpreted() {
+		return scan.parse(vm.expr)
+	}
+	var st vmState
+	if !vm.run(scan, &st, true) {
+		return nil, false
+	}
+	return st.vals[0], true
+}
+
+func (vm *VM) Match(scan *Scanner) bool {
+	if scan.interpreted() {
+		return scan.match(vm.expr)
+	}
+	var st vmState
+	return vm.run(scan, &st, false)
+}
+
+func (vm *VM) run(scan *Scanner, st *vmState, build bool) bool {
+	pc := 0
+	text := scan.Text
+	for {
+		i := &vm.code[pc]
+		fail := false
+		switch i.op {
+		case opChar:
+			scan.examine(scan.Pos + 1)
+			if scan.Pos < len(text) && text[scan.Pos] == i.b {
+				vm.leaf(scan, st, build, scan.Pos, scan.Pos+1)
+				pc++
+			} else {
+				fail = true
+			}
+		case opString:
+			s := vm.strs[i.x]
+			start := scan.Pos
+			n := 0
+			for n < len(s) && start+n < len(text) && text[start+n] == s[n] {
+				n++
+			}
+			if start+n > scan.LPos {
+				scan.LPos = start + n
+			}
+			if n == len(s) {
+				scan.examine(start + n)
+				scan.Pos = start + n
+				vm.push(st, build, scan, start)
+				pc++
+			} else {
+				scan.examine(start + n + 1)
+				fail = true
+			}
+		case opSet:
+			ch, size := utf8.DecodeRuneInString(text[scan.Pos:])
+			scan.examineRune(scan.Pos, size)
+			if size > 0 && vm.sets[i.x].Within(ch) {
+				vm.leaf(scan, st, build, scan.Pos, scan.Pos+size)
+				pc++
+			} else {
+				fail = true
+			}
+		case opTestChar:
+			if scan.Pos < len(text) && text[scan.Pos] == i.b {
+				pc++
+			} else {
+				scan.examine(scan.Pos + 1)
+				pc = i.x
+			}
+		case opTestSet:
+			ch, size := utf8.DecodeRuneInString(text[scan.Pos:])
+			if size > 0 && vm.sets[i.y].Within(ch) {
+				pc++
+			} else {
+				scan.examineRune(scan.Pos, size)
+				pc = i.x
+			}
+		case opChoice, opPredChoice:
+			kind := entryChoice
+			if i.op == opPredChoice {
+				kind = entryPred
+			}
+			st.stack = append(st.stack, vmEntry{
+				kind:   kind,
+				pc:     i.x,
+				pos:    scan.Pos,
+				lpos:   scan.LPos,
+				vals:   len(st.vals),
+				frames: len(st.frames),
+			})
+			pc++
+		case opCommit:
+			st.stack = st.stack[:len(st.stack)-1]
+			pc = i.x
+		case opBackCommit:
+			e := st.stack[len(st.stack)-1]
+			st.stack = st.stack[:len(st.stack)-1]
+			scan.Pos, scan.LPos = e.pos, e.lpos
+			st.vals = st.vals[:e.vals]
+			st.frames = st.frames[:e.frames]
+			pc = i.x
+		case opFailTwice:
+			e := st.stack[len(st.stack)-1]
+			st.stack = st.stack[:len(st.stack)-1]
+			scan.LPos = e.lpos
+			fail = true
+		case opFail:
+			fail = true
+		case opCall:
+			r := vm.rules[i.x]
+			if scan.stats != nil {
+				scan.stats.rule(r.name).Calls++
+			}
+			if scan.memoize(r) {
+				memo, ok := scan.recall(r, scan.Pos, build)
+				if ok {
+					scan.Pos = memo.Pos
+					scan.examine(memo.Reach)
+					scan.LPos = max(scan.LPos, memo.lpos)
+					st.vals = append(st.vals, scan.reuse(memo.Tree))
+					pc++
+					break
+				}
+			}
+			if !scan.step() || !scan.enter() {
+				return false
+			}
+			st.stack = append(st.stack, vmEntry{
+				kind:  entryCall,
+				pc:    pc + 1,
+				pos:   scan.Pos,
+				rule:  i.x,
+				lpos:  scan.LPos,
+				reach: scan.reach,
+			})
+			scan.reach, scan.LPos = scan.Pos, scan.Pos
+			pc = i.y
+		case opReturn:
+			e := st.stack[len(st.stack)-1]
+			st.stack = st.stack[:len(st.stack)-1]
+			scan.leave()
+			r := vm.rules[e.rule]
+			examined, longest := scan.reach, scan.LPos
+			scan.reach, scan.LPos = max(e.reach, examined), max(e.lpos, longest)
+			if scan.memoize(r) {
+				top := &st.vals[len(st.vals)-1]
+				scan.store(r, e.pos, Memo{Pos: scan.Pos, Tree: *top, Reach: examined, lpos: longest})
+				*top = scan.reuse(*top)
+			}
+			pc = e.pc
+		case opEnd:
+			return true
+		case opOpen:
+			st.frames = append(st.frames, vmFrame{scan.Pos, len(st.vals)})
+			pc++
+		case opClose, opRepeatClose:
+			f := st.frames[len(st.frames)-1]
+			if i.op == opRepeatClose && vm.limits[i.x].Under(len(st.vals)-f.vals) {
+				fail = true
+				break
+			}
+			st.frames = st.frames[:len(st.frames)-1]
+			var t *Tree
+			if build {
+				t = scan.newTree(f.pos)
+				t.Child = scan.children(len(st.vals) - f.vals)
+				for _, child := range st.vals[f.vals:] {
+					t.Append(child)
+				}
+			}
+			clear(st.vals[f.vals:])
+			st.vals = append(st.vals[:f.vals], t)
+			pc++
+		case opRepeatCheck:
+			f := st.frames[len(st.frames)-1]
+			if vm.limits[i.x].Over(len(st.vals) - f.vals) {
+				pc = i.y
+			} else {
+				pc++
+			}
+		case opRepeatCommit:
+			e := st.stack[len(st.stack)-1]
+			st.stack = st.stack[:len(st.stack)-1]
+			if scan.Pos == e.pos {
+				// no progress: drop the child and leave the loop
+				st.vals = st.vals[:len(st.vals)-1]
+				pc = e.pc
+			} else {
+				pc = i.x
+			}
+		case opPushNil:
+			st.vals = append(st.vals, nil)
+			pc++
+		case opIndex:
+			if t := st.vals[len(st.vals)-1]; t != nil {
+				t.Index = i.x
+			}
+			pc++
+		case opTag, opRuleTag:
+			if build {
+				t := st.vals[len(st.vals)-1]
+				if t == nil {
+					pos := scan.Pos
+					if i.op == opRuleTag {
+						pos = st.stack[len(st.stack)-1].pos
+					}
+					t = scan.newTree(pos)
+					st.vals[len(st.vals)-1] = t
+				} else if i.op == opTag {
+					// as in Tag.Parse, the memoized tree is not tagged
+					t = t.clone()
+					st.vals[len(st.vals)-1] = t
+				}
+				if i.op == opTag {
+					t.SetTag(vm.tags[i.x])
+				} else {
+					t.SetTag(vm.rules[i.x].tag)
+				}
+			}
+			pc++
+		case opExpr:
+			var t *Tree
+			var ok bool
+			if build {
+				t, ok = scan.parse(vm.exprs[i.x])
+			} else {
+				ok = scan.match(vm.exprs[i.x])
+			}
+			if ok {
+				st.vals = append(st.vals, t)
+				pc++
+			} else {
+				fail = true
+			}
+		}
+		if !fail {
+			continue
+		}
+		if scan.err != nil {
+			return false
+		}
+		// unwind to the most recent choice
+		for {
+			if len(st.stack) == 0 {
+				return false
+			}
+			e := st.stack[len(st.stack)-1]
+			st.stack = st.stack[:len(st.stack)-1]
+			if e.kind == entryCall {
+				scan.leave()
+				scan.reach = max(e.reach, scan.reach)
+				scan.LPos = max(e.lpos, scan.LPos)
+				continue
+			}
+			scan.Pos = e.pos
+			if e.kind == entryPred {
+				scan.LPos = e.lpos
+			}
+			clear(st.vals[e.vals:])
+			st.vals = st.vals[:e.vals]
+			st.frames = st.frames[:e.frames]
+			pc = e.pc
+			break
+		}
+	}
+}
+
+// leaf consumes input up to end and pushes a tree spanning it.
+func (vm *VM) leaf(scan *Scanner, st *vmState, build bool, start, end int) {
+	scan.Pos = end
+	if end > scan.LPos {
+		scan.LPos = end
+	}
+	vm.push(st, build, scan, start)
+}
+
+func (vm *VM) push(st *vmState, build bool, scan *Scanner, start int) {
+	var t *Tree
+	if build {
+		t = scan.newTree(start)
+		t.End = scan.Pos
+	}
+	st.vals = append(st.vals, t)
+}
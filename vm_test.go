@@ -0,0 +1,80 @@
+package peg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVM(t *testing.T) {
+	tests := []struct {
+		name string
+		g    Expr
+		text string
+	}{
+		{"range", newRangeGrammar(), "3..15|48..279|4094"},
+		{"range partial", newRangeGrammar(), "3..15|48."},
+		{"ipv4", newIPv4PrefixGrammar(), "192.168.30.254/24"},
+		{"ipv4 partial", newIPv4PrefixGrammar(), "192.168.30.254"},
+		{"nest", newNestGrammar(), "((((x))))"},
+		{"nest partial", newNestGrammar(), "((((x)))"},
+		{"predicates", NewSequence(
+			NewAnd(NewLiteral("ab")),
+			NewNot(NewLiteral("abd")),
+			NewTag("word", NewOneOrMore(NewCharclass(RuneRange{'a', 'z'}))),
+			NewOptional(NewLiteral("!")),
+			NewRepeat(NewLiteral("-"), NewLimit(1, 2)),
+			EOT,
+		), "abc!--"},
+		{"heads", NewOneOrMore(NewChoice(
+			NewSequence(NewLiteral("abc"), NewLiteral("!")),
+			NewTag("ab", NewSequence(NewLiteral("ab"), NewNot(NewLiteral("c")))),
+			NewExpect(NewCharclass(RuneRange{'0', '9'}), "digit"),
+			NewLiteral("é"),
+		)), "abc!ab7éabcd"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			vm, err := Compile(tc.g)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := NewScanner(tc.text)
+			wt, wok := tc.g.Parse(want)
+			got := NewScanner(tc.text)
+			gt, gok := vm.Parse(got)
+			if gok != wok {
+				t.Fatalf("want %v; but got %v", wok, gok)
+			}
+			if got.LPos != want.LPos {
+				t.Errorf("want lpos %v; but got %v", want.LPos, got.LPos)
+			}
+			if wok && !sameTree(wt, gt) {
+				t.Errorf("trees differ")
+			}
+			scan, ok := Match(vm, tc.text)
+			if ok != wok || scan.LPos != want.LPos {
+				t.Errorf("match: want %v, %v; but got %v, %v", wok, want.LPos, ok, scan.LPos)
+			}
+		})
+	}
+}
+
+func TestVMDeepNesting(t *testing.T) {
+	n := 100000
+	text := strings.Repeat("(", n) + "x" + strings.Repeat(")", n)
+	vm, err := Compile(newNestGrammar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	scan := NewScanner(text, WithDefaultMemo(false))
+	if _, ok := vm.Parse(scan); !ok {
+		t.Fatalf("not accepted")
+	}
+	scan = NewScanner(text, WithMaxDepth(1000))
+	if _, ok := vm.Parse(scan); ok {
+		t.Fatalf("want rejected")
+	}
+	if _, ok := scan.Err().(*DepthLimitError); !ok {
+		t.Errorf("want *DepthLimitError; but got %v", scan.Err())
+	}
+}
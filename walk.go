@@ -0,0 +1,165 @@
+package peg
+
+// children returns the direct subexpressions of a built-in expression.
+func children(e Expr) []Expr {
+	switch e := e.(type) {
+	case *Sequence:
+		return e.exprs
+	case *Choice:
+		return e.exprs
+	case *Repeat:
+		return []Expr{e.expr}
+	case *Optional:
+		return []Expr{e.expr}
+	case *And:
+		return []Expr{e.expr}
+	case *Not:
+		return []Expr{e.expr}
+	case *Tag:
+		return []Expr{e.expr}
+	case *Expect:
+		return []Expr{e.expr}
+	case *Rule:
+		if e.expr == nil {
+			return nil
+		}
+		return []Expr{e.expr}
+	default:
+		return nil
+	}
+}
+
+// rules returns every rule reachable from e, in order of first visit.
+func rules(e Expr) []*Rule {
+	var list []*Rule
+	seen := make(map[*Rule]bool)
+	var visit func(Expr)
+	visit = func(e Expr) {
+		if r, ok := e.(*Rule); ok {
+			if seen[r] {
+				return
+			}
+			seen[r] = true
+			list = append(list, r)
+		}
+		for _, c := range children(e) {
+			visit(c)
+		}
+	}
+	visit(e)
+	return list
+}
+
+// nullable reports whether e can succeed without consuming input.
+// Rules are assumed non-nullable while their definition is being examined.
+func nullable(e Expr) bool {
+	return nullableIn(e, make(map[*Rule]bool))
+}
+
+func nullableIn(e Expr, visiting map[*Rule]bool) bool {
+	switch e := e.(type) {
+	case *Literal:
+		return len(e.text) == 0
+	case *Charclass:
+		return false
+	case *literalSet:
+		return e.empty >= 0
+	case *Sequence:
+		for _, c := range e.exprs {
+			if !nullableIn(c, visiting) {
+				return false
+			}
+		}
+		return true
+	case *Choice:
+		for _, c := range e.exprs {
+			if nullableIn(c, visiting) {
+				return true
+			}
+		}
+		return false
+	case *Repeat:
+		return !e.limit.lowervalid || e.limit.lower == 0 || nullableIn(e.expr, visiting)
+	case *Optional, *And, *Not:
+		return true
+	case *Tag:
+		return nullableIn(e.expr, visiting)
+	case *Expect:
+		return nullableIn(e.expr, visiting)
+	case *Rule:
+		if visiting[e] || e.expr == nil {
+			return false
+		}
+		visiting[e] = true
+		defer delete(visiting, e)
+		return nullableIn(e.expr, visiting)
+	default:
+		return false
+	}
+}
+
+// rewrite copies the graph reachable from e. Every rule is replaced by a
+// new rule with the same name and settings, whose definition is body
+// applied to the old rule and the copy of its definition.
+func rewrite(e Expr, body func(r *Rule, def Expr) Expr) Expr {
+	w := &rewriter{
+		rules: make(map[*Rule]*Rule),
+		body:  body,
+	}
+	e = w.copy(e)
+	for len(w.queue) > 0 {
+		r := w.queue[0]
+		w.queue = w.queue[1:]
+		nr := w.rules[r]
+		if r.expr != nil {
+			nr.expr = w.body(r, w.copy(r.expr))
+		}
+	}
+	number(e)
+	return e
+}
+
+type rewriter struct {
+	rules map[*Rule]*Rule
+	queue []*Rule
+	body  func(r *Rule, def Expr) Expr
+}
+
+func (w *rewriter) copy(e Expr) Expr {
+	switch e := e.(type) {
+	case *Sequence:
+		return NewSequence(w.copyAll(e.exprs)...)
+	case *Choice:
+		return NewChoice(w.copyAll(e.exprs)...)
+	case *Repeat:
+		return NewRepeat(w.copy(e.expr), e.limit)
+	case *Optional:
+		return NewOptional(w.copy(e.expr))
+	case *And:
+		return NewAnd(w.copy(e.expr))
+	case *Not:
+		return NewNot(w.copy(e.expr))
+	case *Tag:
+		return NewTag(e.name, w.copy(e.expr))
+	case *Expect:
+		return NewExpect(w.copy(e.expr), e.msg)
+	case *Rule:
+		nr, ok := w.rules[e]
+		if !ok {
+			nr = e.copy()
+			w.rules[e] = nr
+			w.queue = append(w.queue, e)
+		}
+		return nr
+	default:
+		return e
+	}
+}
+
+func (w *rewriter) copyAll(exprs []Expr) []Expr {
+	list := make([]Expr, len(exprs))
+	for i, e := range exprs {
+		list[i] = w.copy(e)
+	}
+	return list
+}